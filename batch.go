@@ -0,0 +1,220 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+const batchWorkers = 8 // default for WithBatchWorkers
+
+// WithFailFastBatch makes GetGeoDataBatch all or nothing: the first IP the
+// provider fails on (ErrUpstreamUnavailable or ErrRateLimited) is the
+// batch's error and the batch stops waiting on the rest, for pipelines
+// that can't use partial data.  IPs it didn't get to keep their
+// placeholder; lookups already underway still finish into the cache.
+// Non-routable IPs and cache misses aren't failures.  By default a batch
+// is best-effort, with each IP's failure on its own Error field.
+func WithFailFastBatch(on bool) Option {
+	return func(l *GeoLocator) { l.failFast = on }
+}
+
+// GetGeoDataBatch looks up ips much faster than calling GetGeoData in a
+// loop: the cache is read in one round trip and the misses go to the
+// provider from a bounded pool of workers.  results[i] is the answer for
+// ips[i]; duplicates are looked up once, and a miss another GetGeoData or
+// GetGeoDataBatch call is already looking up waits for that lookup
+// rather than making its own.  Per-IP failures are on each entry's Error
+// field as usual.  If ctx is cancelled, IPs not yet looked up keep their
+// placeholder and ctx.Err() is returned.  With no cache configured the
+// valid IPs keep their placeholder and the error is ErrNoCache, as from
+// GetGeoData.
+func GetGeoDataBatch(ctx context.Context, ips []string) ([]GeoIPData, error) {
+	return std().GetGeoDataBatch(ctx, ips)
+}
+
+// GetGeoDataBatch is the batch form of GetGeoData, see the package-level
+// GetGeoDataBatch.
+func (l *GeoLocator) GetGeoDataBatch(ctx context.Context, ips []string) ([]GeoIPData, error) {
+	ctx, span := l.tracer.Start(ctx, "geolocate.GetGeoDataBatch", trace.WithAttributes(attribute.Int("geo.count", len(ips))))
+	defer span.End()
+
+	results := make([]GeoIPData, len(ips))
+	pending := make(map[string][]int) // cache key -> indexes it answers
+	var keys []string
+	for i, ip := range ips {
+		if l.testIP != "" && ip == l.testIP {
+			results[i] = l.testIPData
+			continue
+		}
+		if geo, ok := matchOverride(l.overrides, ip); ok {
+			l.metrics.answered(geo.Provider)
+			results[i] = geo
+			l.logResult(geo)
+			continue
+		}
+		results[i] = newGeoIPData(ip)
+		if _, ok := parseAddr(results[i].IP); !ok {
+			results[i].Provider = "invalid"
+			results[i].Error = "Invalid IP address"
+			continue
+		}
+		key := cacheKey(ip)
+		if _, ok := pending[key]; !ok {
+			keys = append(keys, key)
+		}
+		pending[key] = append(pending[key], i)
+	}
+
+	if l.cache == nil {
+		if len(keys) > 0 {
+			l.errorf("Warning: no cache - REDIS_CONF not set")
+		}
+		for _, key := range keys {
+			l.logResult(results[pending[key][0]])
+		}
+		if len(keys) > 0 {
+			return results, ErrNoCache
+		}
+		return results, nil
+	}
+
+	_, cspan := l.tracer.Start(ctx, "geolocate.cache", trace.WithAttributes(attribute.Int("geo.count", len(keys))))
+	cached := l.getMulti(ctx, keys)
+	cspan.SetAttributes(attribute.Int("geo.cache_hits", len(cached)))
+	cspan.End()
+	var misses []string
+	for _, key := range keys {
+		geo := results[pending[key][0]]
+		if c, ok := cached[key]; ok && !l.tooCoarse(c) {
+			geo.fromCache(c)
+			geo.CacheHit = true
+			if !placeholderCountry(geo.CountryCode) || geo.Provider == providerNegative {
+				l.cacheResult(true)
+				l.revalidateIfStale(geo)
+				l.logResult(geo)
+				fill(results, pending[key], geo)
+				continue
+			}
+			// cached but never updated by the geo api
+			fill(results, pending[key], geo)
+		}
+		l.cacheResult(false)
+		misses = append(misses, key)
+	}
+
+	if l.synchronous {
+		return results, l.resolveInline(ctx, results, pending, misses)
+	}
+	if l.failFast {
+		return results, l.resolveFailFast(ctx, results, pending, misses)
+	}
+	workers := min(max(l.workers, 1), len(misses))
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for n := 0; n < workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range work {
+				lctx, cancel := l.withLookupTimeout(ctx)
+				geo, _ := l.resolveOrCached(lctx, results[pending[key][0]])
+				cancel()
+				fill(results, pending[key], geo)
+			}
+		}()
+	}
+feed:
+	for _, key := range misses {
+		select {
+		case work <- key:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return results, ctx.Err()
+}
+
+// resolveFailFast looks up misses like GetGeoDataBatch's workers, but
+// stops at the first provider failure, see WithFailFastBatch.
+func (l *GeoLocator) resolveFailFast(ctx context.Context, results []GeoIPData, pending map[string][]int, misses []string) error {
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(max(l.workers, 1))
+	for _, key := range misses {
+		if gctx.Err() != nil {
+			break
+		}
+		g.Go(func() error {
+			lctx, cancel := l.withLookupTimeout(gctx)
+			defer cancel()
+			geo, err := l.resolveOrCached(lctx, results[pending[key][0]])
+			fill(results, pending[key], geo)
+			if failsBatch(err) {
+				return err
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// resolveInline looks misses up one at a time in the caller's goroutine,
+// see WithSynchronous.
+func (l *GeoLocator) resolveInline(ctx context.Context, results []GeoIPData, pending map[string][]int, misses []string) error {
+	for _, key := range misses {
+		if ctx.Err() != nil {
+			break
+		}
+		lctx, cancel := l.withLookupTimeout(ctx)
+		geo, err := l.resolveOrCached(lctx, results[pending[key][0]])
+		cancel()
+		fill(results, pending[key], geo)
+		if l.failFast && failsBatch(err) {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+// failsBatch reports whether err is a provider failure, which ends a
+// WithFailFastBatch batch.
+func failsBatch(err error) bool {
+	return errors.Is(err, ErrUpstreamUnavailable) || errors.Is(err, ErrRateLimited)
+}
+
+// fill sets every index in idx to geo.  Each key's indexes belong to one
+// worker, so no locking is needed.
+func fill(results []GeoIPData, idx []int, geo GeoIPData) {
+	for _, i := range idx {
+		results[i] = geo
+	}
+}
+
+// getMulti reads keys from the cache, in one round trip if it supports
+// that.  A cache error reads as all misses.
+func (l *GeoLocator) getMulti(ctx context.Context, keys []string) map[string]GeoIPData {
+	if mg, ok := l.cache.(multiGetter); ok {
+		found, err := mg.GetMulti(ctx, keys)
+		if err != nil {
+			l.warnf("GetGeoDataBatch cache read failed - %s", err)
+			return nil
+		}
+		return found
+	}
+	found := make(map[string]GeoIPData, len(keys))
+	for _, key := range keys {
+		if geo, err := l.cache.Get(ctx, key); err == nil {
+			found[key] = geo
+		}
+	}
+	return found
+}
@@ -0,0 +1,210 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetGeoDataBatch(t *testing.T) {
+	mr := useMiniredis(t)
+	mr.Set("geo:9.9.9.9", `{"ip":"9.9.9.9","isp":"Quad9","country_code":"CH","success":true}`)
+
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		fmt.Fprintf(w, `{"ip":%q,"isp":"ISP %s","country_code":"US","success":true}`, ip, ip)
+	}))
+	defer srv.Close()
+	oldURL := lookupURL
+	lookupURL = srv.URL + "/%s"
+	defer func() { lookupURL = oldURL }()
+
+	ips := []string{"8.8.8.8", "9.9.9.9", "10.0.0.1", "1.1.1.1", "8.8.8.8"}
+	got, err := GetGeoDataBatch(context.Background(), ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ISP 8.8.8.8", "Quad9", "-----", "ISP 1.1.1.1", "ISP 8.8.8.8"}
+	for i := range ips {
+		if got[i].ISP != want[i] {
+			t.Errorf("%s want: %s\ngot: %s\n", ips[i], want[i], got[i].ISP)
+		}
+	}
+	if !got[1].CacheHit || got[0].CacheHit {
+		t.Errorf("want: only 9.9.9.9 from cache\ngot: %v %v\n", got[1].CacheHit, got[0].CacheHit)
+	}
+	if got[2].Provider != "non-routable" {
+		t.Errorf("want: non-routable\ngot: %s\n", got[2].Provider)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("want: 2 provider calls\ngot: %d\n", n)
+	}
+	if !mr.Exists("geo:1.1.1.1") {
+		t.Errorf("want: 1.1.1.1 cached\ngot: missing\n")
+	}
+}
+
+func TestGetGeoDataBatchCancelled(t *testing.T) {
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL("http://127.0.0.1:1/%s"))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	got, err := l.GetGeoDataBatch(ctx, []string{"8.8.8.8", "1.1.1.1"})
+	if err != context.Canceled {
+		t.Errorf("want: %v\ngot: %v\n", context.Canceled, err)
+	}
+	if len(got) != 2 || got[0].IP != "8.8.8.8" {
+		t.Errorf("want: placeholders in order\ngot: %+v\n", got)
+	}
+}
+
+func TestGetGeoDataBatchNoCache(t *testing.T) {
+	l := NewGeoLocator(nil, WithRedisAddr(""))
+	got, err := l.GetGeoDataBatch(context.Background(), []string{"8.8.8.8", "bogus"})
+	if !errors.Is(err, ErrNoCache) {
+		t.Errorf("want: ErrNoCache\ngot: %v\n", err)
+	}
+	if len(got) != 2 || got[0].IP != "8.8.8.8" || got[1].Provider != "invalid" {
+		t.Errorf("want: placeholder, invalid\ngot: %+v\n", got)
+	}
+
+	// nothing to look up, nothing missing
+	if _, err := l.GetGeoDataBatch(context.Background(), []string{"bogus"}); err != nil {
+		t.Errorf("invalid only want: nil\ngot: %v\n", err)
+	}
+}
+
+func TestGetGeoDataBatchConcurrent(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		mu.Lock()
+		hits[ip]++
+		mu.Unlock()
+		<-release
+		fmt.Fprintf(w, `{"ip":%q,"isp":"ISP %s","country_code":"US","success":true}`, ip, ip)
+	}))
+	defer srv.Close()
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"))
+	defer l.Close()
+
+	batches := [][]string{{"8.8.8.8", "1.1.1.1"}, {"1.1.1.1", "8.8.8.8", "9.9.9.9"}}
+	results := make([][]GeoIPData, len(batches))
+	var wg sync.WaitGroup
+	for i, ips := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _ = l.GetGeoDataBatch(context.Background(), ips)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond) // let both batches reach the provider
+	close(release)
+	wg.Wait()
+
+	for i, ips := range batches {
+		for j, ip := range ips {
+			if want := "ISP " + ip; results[i][j].ISP != want {
+				t.Errorf("batch %d %s want: %s\ngot: %s\n", i, ip, want, results[i][j].ISP)
+			}
+		}
+	}
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1", "9.9.9.9"} {
+		if hits[ip] != 1 {
+			t.Errorf("%s want: 1 provider call\ngot: %d\n", ip, hits[ip])
+		}
+	}
+}
+
+func TestWithFailFastBatch(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		if ip == "1.1.1.1" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		<-release
+		fmt.Fprintf(w, `{"ip":%q,"isp":"ISP %s","country_code":"US","success":true}`, ip, ip)
+	}))
+	defer srv.Close()
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"), WithFailFastBatch(true))
+	defer l.Close()
+	defer close(release)
+
+	done := make(chan struct{})
+	var got []GeoIPData
+	var err error
+	go func() {
+		got, err = l.GetGeoDataBatch(context.Background(), []string{"8.8.8.8", "1.1.1.1", "10.0.0.1"})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("want: the batch to stop at the first failure\ngot: still waiting\n")
+	}
+	if !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("want: ErrUpstreamUnavailable\ngot: %v\n", err)
+	}
+	if got[0].ISP != "-----" || got[2].Provider != "non-routable" {
+		t.Errorf("want: 8.8.8.8 left as the placeholder, 10.0.0.1 non-routable\ngot: %s %s\n", got[0].ISP, got[2].Provider)
+	}
+}
+
+func TestWithSynchronous(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	var inFlight, most atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := inFlight.Add(1); n > most.Load() {
+			most.Store(n)
+		}
+		defer inFlight.Add(-1)
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		mu.Lock()
+		order = append(order, ip)
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+		fmt.Fprintf(w, `{"ip":%q,"isp":"ISP %s","country_code":"US","success":true}`, ip, ip)
+	}))
+	defer srv.Close()
+
+	mem := NewMemoryCache(10)
+	mem.Set(context.Background(), "4.4.4.4", GeoIPData{IP: "4.4.4.4", ISP: "Old ISP", CountryCode: "US", FetchedAt: time.Now().Add(-time.Hour)}, 0)
+	l := NewGeoLocator(nil, WithCache(mem), WithLookupURL(srv.URL+"/%s"), WithSynchronous(true), WithStaleAfter(time.Minute))
+	defer l.Close()
+
+	ips := []string{"8.8.8.8", "1.1.1.1", "9.9.9.9", "1.1.1.1"}
+	got, err := l.GetGeoDataBatch(context.Background(), ips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, ip := range ips {
+		if got[i].ISP != "ISP "+ip {
+			t.Errorf("%s want: ISP %s\ngot: %s\n", ip, ip, got[i].ISP)
+		}
+	}
+	if want := "8.8.8.8 1.1.1.1 9.9.9.9"; strings.Join(order, " ") != want || most.Load() != 1 {
+		t.Errorf("want: %s one at a time\ngot: %v, %d at once\n", want, order, most.Load())
+	}
+
+	// the stale answer comes back after its refresh, not alongside it
+	if geo, _ := l.GetGeoData(context.Background(), "4.4.4.4"); geo.ISP != "Old ISP" {
+		t.Errorf("want: Old ISP\ngot: %s\n", geo.ISP)
+	}
+	if geo, _ := mem.Get(context.Background(), "4.4.4.4"); geo.ISP != "ISP 4.4.4.4" {
+		t.Errorf("refreshed want: ISP 4.4.4.4\ngot: %s\n", geo.ISP)
+	}
+}
@@ -0,0 +1,104 @@
+package me_geolocate
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned when a provider has failed too often to be
+// called, see WithCircuitBreaker.
+var ErrCircuitOpen = errors.New("me_geolocate: provider circuit open")
+
+// BreakerPolicy says when to stop calling a provider that is down.
+type BreakerPolicy struct {
+	Failures int           // failed calls in a row that open the circuit; 0 = no breaker
+	OpenFor  time.Duration // how long it stays open before calls are tried again
+	Probes   int           // calls let through to test it once OpenFor is up; below 1 means 1
+}
+
+// WithCircuitBreaker stops calling a provider for a while once it has
+// failed p.Failures times in a row, so lookups fail fast with
+// ErrCircuitOpen, or fail over to the next provider, rather than each
+// waiting out a timeout.  Only failures WithRetry would retry count:
+// network errors, timeouts, 429s and 5xxs.
+func WithCircuitBreaker(p BreakerPolicy) Option {
+	return func(l *GeoLocator) { l.breakerPolicy = p }
+}
+
+const (
+	breakerClosed   = "closed"
+	breakerOpen     = "open"
+	breakerHalfOpen = "half-open"
+)
+
+// circuitBreaker guards one provider.  A nil breaker always allows.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	policy   BreakerPolicy
+	state    string
+	failures int
+	openedAt time.Time
+	probes   int // calls let through while half-open
+}
+
+func newCircuitBreaker(p BreakerPolicy) *circuitBreaker {
+	if p.Failures <= 0 {
+		return nil
+	}
+	if p.Probes < 1 {
+		p.Probes = 1
+	}
+	return &circuitBreaker{policy: p, state: breakerClosed}
+}
+
+func (b *circuitBreaker) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.policy.OpenFor {
+			return false
+		}
+		b.state, b.probes = breakerHalfOpen, 0
+		fallthrough
+	case breakerHalfOpen:
+		if b.probes >= b.policy.Probes {
+			return false
+		}
+		b.probes++
+	}
+	return true
+}
+
+// record notes how a call let through by allow went.
+func (b *circuitBreaker) record(err error) {
+	if b == nil {
+		return
+	}
+	var re *retryableError
+	failed := errors.As(err, &re)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !failed {
+		b.state, b.failures = breakerClosed, 0
+		return
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.policy.Failures {
+		b.state, b.openedAt = breakerOpen, time.Now()
+	}
+}
+
+func (b *circuitBreaker) current() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.policy.OpenFor {
+		return breakerHalfOpen
+	}
+	return b.state
+}
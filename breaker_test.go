@@ -0,0 +1,73 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var hits atomic.Int32
+	var down atomic.Bool
+	down.Store(true)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"isp":"Google LLC","country_code":"US","success":true}`)
+	}))
+	defer srv.Close()
+
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"),
+		WithCircuitBreaker(BreakerPolicy{Failures: 2, OpenFor: 50 * time.Millisecond}))
+	defer l.Close()
+	ctx := context.Background()
+
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1"} {
+		if _, err := l.GetGeoData(ctx, ip); errors.Is(err, ErrCircuitOpen) {
+			t.Errorf("want: %s tried\ngot: %v\n", ip, err)
+		}
+	}
+	_, err := l.GetGeoData(ctx, "9.9.9.9")
+	if !errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUpstreamUnavailable) || hits.Load() != 2 {
+		t.Errorf("want: ErrCircuitOpen without calling the provider\ngot: %v after %d calls\n", err, hits.Load())
+	}
+	if h := l.Health(); h.Providers["geoiplookup.io"] != "open" {
+		t.Errorf("want: open\ngot: %v\n", h.Providers)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	down.Store(false)
+	if geo, err := l.GetGeoData(ctx, "9.9.9.9"); err != nil || geo.ISP != "Google LLC" {
+		t.Errorf("want: probe answered\ngot: %s %v\n", geo.ISP, err)
+	}
+	if h := l.Health(); h.Providers["geoiplookup.io"] != "closed" {
+		t.Errorf("want: closed\ngot: %v\n", h.Providers)
+	}
+}
+
+func TestCircuitBreakerFailover(t *testing.T) {
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer bad.Close()
+	good := providerServer(t, `{"ip":"8.8.8.8","country":"US","org":"AS15169 Google LLC"}`, nil)
+
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)),
+		WithProviderChain(&GeoIPLookupProvider{URL: bad.URL + "/%s"}, &IPInfoProvider{URL: good + "/%s/json"}),
+		WithCircuitBreaker(BreakerPolicy{Failures: 1, OpenFor: time.Hour}))
+	defer l.Close()
+
+	for _, ip := range []string{"8.8.8.8", "8.8.4.4"} {
+		if geo, err := l.GetGeoData(context.Background(), ip); err != nil || geo.Provider != "ipinfo.io" {
+			t.Errorf("want: %s answered by ipinfo.io\ngot: %s %v\n", ip, geo.Provider, err)
+		}
+	}
+}
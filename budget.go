@@ -0,0 +1,105 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// how long WithLatencyBudget keeps a stale copy past the entry's TTL, if
+// not given
+const defaultStaleKeep = 7 * 24 * time.Hour
+
+// providerStaleTimeout is GeoIPData.Provider for an expired entry served
+// because the provider was over the latency budget.
+const providerStaleTimeout = "stale_timeout"
+
+// stalePrefix marks the cache keys of the copies WithLatencyBudget keeps.
+const stalePrefix = "stale:"
+
+// WithLatencyBudget bounds how long GetGeoData waits on the provider
+// when the cache has only an expired entry for the IP.  If the provider
+// hasn't answered within budget the expired entry is returned, with
+// Provider "stale_timeout", and the lookup finishes in the background to
+// refresh the cache.  With no expired entry, or if the provider fails
+// outright, it waits as usual.
+//
+// To have expired entries to fall back on, each cache write also keeps a
+// copy for keep past its TTL, a second key per IP; keep 0 means a week.
+// Entries that never expire and cached failures aren't copied.
+func WithLatencyBudget(budget, keep time.Duration) Option {
+	return func(l *GeoLocator) {
+		if keep <= 0 {
+			keep = defaultStaleKeep
+		}
+		l.latencyBudget, l.staleKeep = budget, keep
+	}
+}
+
+// resolveWithinBudget is resolveOrCached, bounded by WithLatencyBudget.
+func (l *GeoLocator) resolveWithinBudget(ctx context.Context, geo GeoIPData) (GeoIPData, error) {
+	if l.stale == nil || geo.CacheHit {
+		return l.resolveOrCached(ctx, geo)
+	}
+	old, err := l.stale.getStale(ctx, cacheKey(geo.IP))
+	if err != nil {
+		return l.resolveOrCached(ctx, geo)
+	}
+	bctx, cancel := context.WithTimeout(ctx, l.latencyBudget)
+	defer cancel()
+	res, err := l.resolve(bctx, geo)
+	if err == nil || ctx.Err() != nil || !errors.Is(bctx.Err(), context.DeadlineExceeded) {
+		return res, err
+	}
+	l.warnf("GetGeoData provider over the %s budget for IP: %s - serving the expired entry", l.latencyBudget, logIP(geo.IP))
+	old.fromCache(old)
+	old.CacheHit = true
+	old.Provider = providerStaleTimeout
+	l.logResult(old)
+	return old, nil
+}
+
+// staleCache keeps a copy of each entry Set, under stalePrefix, for keep
+// past its TTL, see WithLatencyBudget.
+type staleCache struct {
+	Cache
+	keep time.Duration
+}
+
+func (c *staleCache) Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error {
+	if err := c.Cache.Set(ctx, key, geo, ttl); err != nil {
+		return err
+	}
+	if ttl <= 0 || geo.Provider == providerNegative {
+		return nil
+	}
+	return c.Cache.Set(ctx, stalePrefix+key, geo, ttl+c.keep)
+}
+
+// Delete drops the stale copy too, so an invalidated entry isn't served.
+func (c *staleCache) Delete(ctx context.Context, key string) error {
+	c.Cache.Delete(ctx, stalePrefix+key)
+	return c.Cache.Delete(ctx, key)
+}
+
+func (c *staleCache) GetMulti(ctx context.Context, keys []string) (map[string]GeoIPData, error) {
+	if mg, ok := c.Cache.(multiGetter); ok {
+		return mg.GetMulti(ctx, keys)
+	}
+	found := make(map[string]GeoIPData, len(keys))
+	for _, key := range keys {
+		if geo, err := c.Cache.Get(ctx, key); err == nil {
+			found[key] = geo
+		}
+	}
+	return found, nil
+}
+
+func (c *staleCache) ttl(ctx context.Context, key string) (time.Duration, error) {
+	return remainingTTL(ctx, c.Cache, key)
+}
+
+// getStale is the copy kept for key, expired or not.
+func (c *staleCache) getStale(ctx context.Context, key string) (GeoIPData, error) {
+	return c.Cache.Get(ctx, stalePrefix+key)
+}
@@ -0,0 +1,69 @@
+package me_geolocate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithLatencyBudget(t *testing.T) {
+	var isp atomic.Value
+	isp.Store("Old ISP")
+	var slow atomic.Bool
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			<-release
+		}
+		fmt.Fprintf(w, `{"isp":%q,"country_code":"US","success":true}`, isp.Load())
+	}))
+	defer srv.Close()
+
+	mem := NewMemoryCache(10)
+	l := NewGeoLocator(nil, WithCache(mem), WithLookupURL(srv.URL+"/%s"), WithTTL(20*time.Millisecond),
+		WithLatencyBudget(50*time.Millisecond, time.Hour))
+	ctx := context.Background()
+	if geo, err := l.GetGeoData(ctx, "8.8.8.8"); err != nil || geo.ISP != "Old ISP" {
+		t.Fatalf("want: Old ISP\ngot: %s %v\n", geo.ISP, err)
+	}
+	time.Sleep(30 * time.Millisecond) // expire it
+
+	// the provider is over budget, so the expired entry comes back
+	isp.Store("New ISP")
+	slow.Store(true)
+	start := time.Now()
+	geo, err := l.GetGeoData(ctx, "8.8.8.8")
+	if err != nil || geo.ISP != "Old ISP" || geo.Provider != providerStaleTimeout || !geo.CacheHit {
+		t.Errorf("want: Old ISP, stale_timeout\ngot: %s %s %v\n", geo.ISP, geo.Provider, err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("want: an answer within the budget\ngot: %s\n", waited)
+	}
+
+	// the lookup carries on and refreshes the cache
+	close(release)
+	l.Close()
+	if cached, _ := mem.Get(ctx, "8.8.8.8"); cached.ISP != "New ISP" {
+		t.Errorf("cached want: New ISP\ngot: %s\n", cached.ISP)
+	}
+	if stale, _ := mem.Get(ctx, stalePrefix+"8.8.8.8"); stale.ISP != "New ISP" {
+		t.Errorf("stale copy want: New ISP\ngot: %s\n", stale.ISP)
+	}
+
+	// with nothing expired to fall back on, the provider is waited for
+	slow.Store(true)
+	release = make(chan struct{})
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		close(release)
+	}()
+	l = NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"), WithLatencyBudget(10*time.Millisecond, 0))
+	defer l.Close()
+	if geo, err := l.GetGeoData(ctx, "8.8.8.8"); err != nil || geo.ISP != "New ISP" {
+		t.Errorf("want: New ISP from the provider\ngot: %s %s %v\n", geo.ISP, geo.Provider, err)
+	}
+}
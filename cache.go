@@ -0,0 +1,175 @@
+package me_geolocate
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Cache stores lookup results for a GeoLocator, keyed by canonical IP.
+// Get returns ErrCacheMiss for a key it doesn't hold.  A ttl of 0 means
+// the entry doesn't expire.  Implementations must be safe for concurrent
+// use.
+type Cache interface {
+	Get(ctx context.Context, key string) (GeoIPData, error)
+	Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// multiGetter is a Cache that can fetch many keys in one round trip.  The
+// result only holds the keys that were found.
+type multiGetter interface {
+	GetMulti(ctx context.Context, keys []string) (map[string]GeoIPData, error)
+}
+
+// ttlGetter is a Cache that can say how long an entry has left.
+type ttlGetter interface {
+	ttl(ctx context.Context, key string) (time.Duration, error)
+}
+
+// remainingTTL is how long key has left in c, 0 if it doesn't expire, is gone
+// or c can't say.
+func remainingTTL(ctx context.Context, c Cache, key string) (time.Duration, error) {
+	if tg, ok := c.(ttlGetter); ok {
+		return tg.ttl(ctx, key)
+	}
+	return 0, nil
+}
+
+// cacheSchemaVersion is stamped on every Redis entry.  Bump it when a
+// change to GeoIPData means entries already cached would decode wrongly,
+// and teach upgradeEntry to fix up the old version if it can; entries it
+// can't are dropped and looked up again.  New fields alone don't need it.
+const cacheSchemaVersion = 1
+
+var cacheKeyPrefix = "geo:" // see SetCacheKeyPrefix
+
+// cacheEntry is a GeoIPData as stored in Redis.
+type cacheEntry struct {
+	Schema int `json:"schema"`
+	GeoIPData
+}
+
+// SetCacheKeyPrefix sets the namespace for Redis keys, "geo:" by default,
+// so the cache can share a Redis DB with other applications.  An empty
+// prefix stores entries under the bare IP as before; NormalizeCacheKeys
+// moves entries across when the prefix changes.  Call it before the first
+// lookup.
+func SetCacheKeyPrefix(prefix string) {
+	cacheKeyPrefix = prefix
+}
+
+// redisKey is the Redis key holding key, an IP, under the package prefix.
+func redisKey(key string) string {
+	return cacheKeyPrefix + key
+}
+
+// encodeEntry is geo as stored in Redis.
+func encodeEntry(geo GeoIPData) ([]byte, error) {
+	return json.Marshal(cacheEntry{Schema: cacheSchemaVersion, GeoIPData: geo})
+}
+
+// decodeEntry reads an entry written by encodeEntry.  ok is false if it
+// isn't one, or is from a schema version that can't be upgraded.
+func decodeEntry(s string) (GeoIPData, bool) {
+	var entry cacheEntry
+	if json.Unmarshal([]byte(s), &entry) != nil {
+		return GeoIPData{}, false
+	}
+	if !upgradeEntry(entry.Schema, &entry.GeoIPData) {
+		return GeoIPData{}, false
+	}
+	return entry.GeoIPData, true
+}
+
+// upgradeEntry brings geo, cached under schema version, up to date.  It
+// is false if that can't be done.
+func upgradeEntry(version int, geo *GeoIPData) bool {
+	switch version {
+	case cacheSchemaVersion:
+		return true
+	case 0:
+		// written before entries were versioned, same shape as version 1
+		return true
+	}
+	return false
+}
+
+// RedisCache is the Redis-backed Cache, storing each result as JSON under
+// the key prefix, see SetCacheKeyPrefix.
+type RedisCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+// NewRedisCache wraps client as a Cache, using the current key prefix.
+// Closing client is up to the caller.
+func NewRedisCache(client redis.UniversalClient) *RedisCache {
+	return &RedisCache{client: client, prefix: cacheKeyPrefix}
+}
+
+// Get treats an entry from a schema version it can't upgrade as a miss,
+// and deletes it.
+func (c *RedisCache) Get(ctx context.Context, key string) (GeoIPData, error) {
+	jsonResult, err := c.client.Get(ctx, c.prefix+key).Result()
+	if err == redis.Nil {
+		return GeoIPData{}, ErrCacheMiss
+	}
+	if err != nil {
+		return GeoIPData{}, err
+	}
+	geo, ok := decodeEntry(jsonResult)
+	if !ok {
+		c.client.Del(ctx, c.prefix+key)
+		return GeoIPData{}, ErrCacheMiss
+	}
+	return geo, nil
+}
+
+func (c *RedisCache) Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error {
+	jsonResult, err := encodeEntry(geo)
+	if err != nil {
+		return err
+	}
+	return c.client.Set(ctx, c.prefix+key, jsonResult, ttl).Err()
+}
+
+func (c *RedisCache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, c.prefix+key).Err()
+}
+
+func (c *RedisCache) ttl(ctx context.Context, key string) (time.Duration, error) {
+	ttl, err := c.client.TTL(ctx, c.prefix+key).Result()
+	if ttl < 0 {
+		// -1 no expiry, -2 gone since we read it
+		ttl = 0
+	}
+	return ttl, err
+}
+
+// GetMulti pipelines a GET per key rather than sending one MGET, since
+// with a sharded cache the keys can live on different instances.
+func (c *RedisCache) GetMulti(ctx context.Context, keys []string) (map[string]GeoIPData, error) {
+	pipe := c.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, c.prefix+key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return nil, err
+	}
+
+	found := make(map[string]GeoIPData, len(keys))
+	for i, key := range keys {
+		jsonResult, err := cmds[i].Result()
+		if err != nil {
+			continue
+		}
+		if geo, ok := decodeEntry(jsonResult); ok {
+			found[key] = geo
+		}
+	}
+	return found, nil
+}
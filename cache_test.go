@@ -0,0 +1,176 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheLRU(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(2)
+	c.Set(ctx, "1.1.1.1", GeoIPData{IP: "1.1.1.1"}, 0)
+	c.Set(ctx, "8.8.8.8", GeoIPData{IP: "8.8.8.8"}, 0)
+	c.Get(ctx, "1.1.1.1") // 8.8.8.8 is now least recently used
+	c.Set(ctx, "9.9.9.9", GeoIPData{IP: "9.9.9.9"}, 0)
+
+	if _, err := c.Get(ctx, "8.8.8.8"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("want: ErrCacheMiss\ngot: %v\n", err)
+	}
+	for _, ip := range []string{"1.1.1.1", "9.9.9.9"} {
+		if geo, err := c.Get(ctx, ip); err != nil || geo.IP != ip {
+			t.Errorf("want: %s\ngot: %s %v\n", ip, geo.IP, err)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("want: 2\ngot: %d\n", c.Len())
+	}
+
+	c.Delete(ctx, "1.1.1.1")
+	if _, err := c.Get(ctx, "1.1.1.1"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("want: ErrCacheMiss after Delete\ngot: %v\n", err)
+	}
+}
+
+func TestMemoryCacheExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryCache(10)
+	c.Set(ctx, "8.8.8.8", GeoIPData{IP: "8.8.8.8"}, time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	if _, err := c.Get(ctx, "8.8.8.8"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("want: ErrCacheMiss\ngot: %v\n", err)
+	}
+	if c.Len() != 0 {
+		t.Errorf("want: expired entry dropped\ngot: %d entries\n", c.Len())
+	}
+}
+
+func TestRedisCache(t *testing.T) {
+	mr := useMiniredis(t)
+	ctx := context.Background()
+	c := NewRedisCache(redisClient)
+
+	if _, err := c.Get(ctx, "8.8.8.8"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("want: ErrCacheMiss\ngot: %v\n", err)
+	}
+	c.Set(ctx, "8.8.8.8", GeoIPData{IP: "8.8.8.8", ISP: "Google LLC"}, time.Hour)
+	if mr.TTL("geo:8.8.8.8") != time.Hour {
+		t.Errorf("want: 1h\ngot: %s\n", mr.TTL("geo:8.8.8.8"))
+	}
+	if geo, err := c.Get(ctx, "8.8.8.8"); err != nil || geo.ISP != "Google LLC" {
+		t.Errorf("want: Google LLC\ngot: %s %v\n", geo.ISP, err)
+	}
+	c.Delete(ctx, "8.8.8.8")
+	if mr.Exists("geo:8.8.8.8") {
+		t.Errorf("want: deleted\ngot: still cached\n")
+	}
+}
+
+func TestGeoLocatorMemoryCache(t *testing.T) {
+	useProvider(t, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	mem := NewMemoryCache(10)
+	l := NewGeoLocator(nil, WithCache(mem), WithLookupURL(lookupURL))
+	defer l.Close()
+
+	l.GetGeoData(context.Background(), "8.8.8.8")
+	geo, _ := l.GetGeoData(context.Background(), "8.8.8.8")
+	if !geo.CacheHit || geo.ISP != "Google LLC" {
+		t.Errorf("want: cached Google LLC\ngot: %v %s\n", geo.CacheHit, geo.ISP)
+	}
+	if geo.EffectiveTTL != 0 {
+		t.Errorf("want: EffectiveTTL not cached\ngot: %s\n", geo.EffectiveTTL)
+	}
+}
+
+func TestRedisCacheSchema(t *testing.T) {
+	mr := useMiniredis(t)
+	ctx := context.Background()
+	c := NewRedisCache(redisClient)
+
+	c.Set(ctx, "8.8.8.8", GeoIPData{IP: "8.8.8.8", ISP: "Google LLC"}, time.Hour)
+	if got, _ := mr.Get("geo:8.8.8.8"); !strings.Contains(got, `"schema":1`) {
+		t.Errorf("want: schema 1 stamped\ngot: %s\n", got)
+	}
+
+	// from before entries were versioned: still good
+	mr.Set("geo:1.1.1.1", `{"ip":"1.1.1.1","isp":"Cloudflare, Inc."}`)
+	if geo, err := c.Get(ctx, "1.1.1.1"); err != nil || geo.ISP != "Cloudflare, Inc." {
+		t.Errorf("unversioned want: Cloudflare, Inc.\ngot: %s %v\n", geo.ISP, err)
+	}
+
+	// from a schema we can't read: dropped
+	mr.Set("geo:9.9.9.9", `{"schema":99,"ip":"9.9.9.9","isp":"Quad9"}`)
+	if _, err := c.Get(ctx, "9.9.9.9"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("want: ErrCacheMiss\ngot: %v\n", err)
+	}
+	if mr.Exists("geo:9.9.9.9") {
+		t.Errorf("want: unreadable entry deleted\ngot: still cached\n")
+	}
+}
+
+func TestCacheKeyPrefix(t *testing.T) {
+	mr := useMiniredis(t)
+	ctx := context.Background()
+	t.Cleanup(func() { SetCacheKeyPrefix("geo:") })
+
+	SetCacheKeyPrefix("")
+	NewRedisCache(redisClient).Set(ctx, "8.8.8.8", GeoIPData{IP: "8.8.8.8"}, time.Hour)
+	if !mr.Exists("8.8.8.8") {
+		t.Errorf("want: bare key\ngot: %v\n", mr.Keys())
+	}
+
+	SetCacheKeyPrefix("geo:")
+	l := NewGeoLocator(nil, WithRedisAddr(mr.Addr()), WithKeyPrefix("app1:geo:"))
+	defer l.Close()
+	l.cache.Set(ctx, "1.1.1.1", GeoIPData{IP: "1.1.1.1"}, time.Hour)
+	if !mr.Exists("app1:geo:1.1.1.1") {
+		t.Errorf("want: app1:geo:1.1.1.1\ngot: %v\n", mr.Keys())
+	}
+}
+
+func TestTieredCache(t *testing.T) {
+	mr := useMiniredis(t)
+	ctx := context.Background()
+	c := NewTieredCache(NewRedisCache(redisClient), 10, time.Minute)
+
+	c.Set(ctx, "8.8.8.8", GeoIPData{IP: "8.8.8.8", ISP: "Google LLC"}, time.Hour)
+	if !mr.Exists("geo:8.8.8.8") {
+		t.Errorf("want: written through to Redis\ngot: missing\n")
+	}
+	mr.Set("geo:1.1.1.1", `{"schema":1,"ip":"1.1.1.1","isp":"Cloudflare, Inc."}`)
+	if geo, err := c.Get(ctx, "1.1.1.1"); err != nil || geo.ISP != "Cloudflare, Inc." {
+		t.Errorf("want: Cloudflare, Inc.\ngot: %s %v\n", geo.ISP, err)
+	}
+
+	// with no near ttl given, near entries still expire
+	def := NewTieredCache(NewRedisCache(redisClient), 10, 0)
+	def.Set(ctx, "9.9.9.9", GeoIPData{IP: "9.9.9.9", Provider: providerNegative}, time.Second)
+	def.Get(ctx, "8.8.8.8")
+	for ip, want := range map[string]time.Duration{"9.9.9.9": time.Second, "8.8.8.8": defaultNearTTL} {
+		e := def.near.entries[ip].Value.(*memEntry)
+		if left := time.Until(e.expires); e.expires.IsZero() || left > want {
+			t.Errorf("%s want: near entry expiring within %s\ngot: %s\n", ip, want, left)
+		}
+	}
+	def.Delete(ctx, "9.9.9.9")
+
+	mr.Close()
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1"} {
+		if _, err := c.Get(ctx, ip); err != nil {
+			t.Errorf("want: %s served locally while Redis is down\ngot: %v\n", ip, err)
+		}
+	}
+	found, _ := c.GetMulti(ctx, []string{"8.8.8.8", "1.1.1.1"})
+	if len(found) != 2 {
+		t.Errorf("want: 2 found locally\ngot: %d\n", len(found))
+	}
+	if _, err := c.Get(ctx, "9.9.9.9"); err == nil {
+		t.Errorf("want: Redis error for an IP not held locally\ngot: nil\n")
+	}
+	c.Delete(ctx, "8.8.8.8")
+	if _, err := c.near.Get(ctx, "8.8.8.8"); !errors.Is(err, ErrCacheMiss) {
+		t.Errorf("want: deleted locally\ngot: %v\n", err)
+	}
+}
@@ -0,0 +1,322 @@
+package me_geolocate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// canonicalIP returns the canonical text form of ip: a dotted quad for IPv4
+// (including IPv4-mapped IPv6 like ::ffff:8.8.8.8) and the lowercase,
+// compressed form for IPv6.
+func canonicalIP(ip string) (string, bool) {
+	parsed := net.ParseIP(strings.TrimSpace(ip))
+	if parsed == nil {
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// cacheKey is the Redis key for ip.  Anything that parses as an IP is
+// stored under its canonical form, so ::ffff:8.8.8.8 and 8.8.8.8, or
+// 2001:DB8::1 and 2001:db8::1, share one entry.
+func cacheKey(ip string) string {
+	if canon, ok := canonicalIP(ip); ok {
+		return canon
+	}
+	return ip
+}
+
+// NormalizeCacheKeys is a one-shot cleanup for caches written before IPs
+// were canonicalized or keys were prefixed.  It SCANs for IP keys that
+// aren't the canonical form under the current prefix, merges each one into
+// the entry under the canonical key (keeping whichever of the two is more
+// complete, and the longer TTL) and deletes the old key.  Keys that aren't
+// IPs, with or without the prefix, are left alone.  Returns the number of
+// keys merged.
+func NormalizeCacheKeys(ctx context.Context) (int, error) {
+	if redis_addr == "" {
+		return 0, errors.New("NormalizeCacheKeys: REDIS_CONF not set")
+	}
+
+	var merged int32
+	err := forEachShard(ctx, redisClient, func(ctx context.Context, shard *redis.Client) error {
+		iter := shard.Scan(ctx, 0, "*", 1000).Iterator()
+		for iter.Next(ctx) {
+			key := iter.Val()
+			canon, ok := canonicalIP(strings.TrimPrefix(key, cacheKeyPrefix))
+			if !ok || redisKey(canon) == key {
+				continue
+			}
+			// the canonical key may live on another shard, so go through
+			// the routed client from here
+			ok, err := mergeCacheKey(ctx, key, canon)
+			if err != nil {
+				return err
+			}
+			if ok {
+				atomic.AddInt32(&merged, 1)
+			}
+		}
+		return iter.Err()
+	})
+	return int(merged), err
+}
+
+// mergeCacheKey moves the entry at Redis key from onto the one for IP to,
+// unless that already holds a more complete entry.  Either way from is
+// removed.
+func mergeCacheKey(ctx context.Context, from, to string) (bool, error) {
+	best, bestTTL, err := readCacheEntry(ctx, from)
+	if err == redis.Nil {
+		return false, nil // expired while we scanned
+	}
+	if err != nil {
+		return false, err
+	}
+
+	cur, curTTL, err := readCacheEntry(ctx, redisKey(to))
+	switch {
+	case err == redis.Nil:
+	case err != nil:
+		return false, err
+	default:
+		if completeness(cur) >= completeness(best) {
+			best = cur
+		}
+		if curTTL == 0 || (bestTTL != 0 && curTTL > bestTTL) {
+			bestTTL = curTTL
+		}
+	}
+
+	best.IP = to
+	jsonResult, _ := encodeEntry(best)
+	// not a MULTI: the two keys can be on different shards or cluster
+	// slots.  Writing first means a failure leaves both keys, and the
+	// next run merges them again, rather than losing the entry.
+	if err := redisClient.Set(ctx, redisKey(to), jsonResult, bestTTL).Err(); err != nil {
+		return false, err
+	}
+	if err := redisClient.Del(ctx, from).Err(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readCacheEntry returns the entry under key and its remaining TTL, with
+// 0 meaning no expiry.  Values that aren't GeoIPData come back as redis.Nil.
+func readCacheEntry(ctx context.Context, key string) (GeoIPData, time.Duration, error) {
+	jsonResult, err := redisClient.Get(ctx, key).Result()
+	if err != nil {
+		return GeoIPData{}, 0, err
+	}
+	geo, ok := decodeEntry(jsonResult)
+	if !ok {
+		return geo, 0, redis.Nil
+	}
+	ttl, err := redisClient.TTL(ctx, key).Result()
+	if err != nil {
+		return geo, 0, err
+	}
+	if ttl < 0 {
+		ttl = 0
+	}
+	return geo, ttl, nil
+}
+
+// completeness counts the fields of geo that carry real data, so the
+// better of two duplicate entries can be kept.
+func completeness(geo GeoIPData) int {
+	n := 0
+	v := reflect.ValueOf(geo)
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if f.IsZero() {
+			continue
+		}
+		if f.Kind() == reflect.String && (f.String() == "--" || f.String() == "-----" || f.String() == unknownCC) {
+			continue
+		}
+		n++
+	}
+	return n
+}
+
+// DistinctISPs SCANs the cache and returns the sorted, unique ISPs of the
+// entries in it, see GeoLocator.DistinctISPs.
+func DistinctISPs(ctx context.Context) ([]string, error) {
+	return std().DistinctISPs(ctx)
+}
+
+// DistinctISPs SCANs the locator's Redis cache and returns the sorted,
+// unique ISPs of the entries in it, leaving out the "-----" placeholder.
+// It stops between pages of the SCAN once ctx is done.
+func (l *GeoLocator) DistinctISPs(ctx context.Context) ([]string, error) {
+	if l.rcache == nil {
+		return nil, errors.New("DistinctISPs: no Redis cache")
+	}
+
+	seen := make(map[string]bool)
+	err := l.rcache.scanEntries(ctx, func(vals []string) {
+		for _, v := range vals {
+			geo, ok := decodeEntry(v)
+			if !ok {
+				continue
+			}
+			if isp := strings.TrimSpace(geo.ISP); isp != "" && isp != "-----" {
+				seen[isp] = true
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	isps := make([]string, 0, len(seen))
+	for isp := range seen {
+		isps = append(isps, isp)
+	}
+	sort.Strings(isps)
+	return isps, nil
+}
+
+// CachedSubset splits ips into those already in the cache and those that
+// aren't, see GeoLocator.CachedSubset.
+func CachedSubset(ctx context.Context, ips []string) (cached []string, missing []string, err error) {
+	return std().CachedSubset(ctx, ips)
+}
+
+// CachedSubset splits ips into those already in the locator's Redis cache
+// and those that aren't, for sizing a batch before fetching it.  Inputs
+// are canonicalized and deduped first, and both slices keep the order the
+// IPs first appear in.  A single pipelined EXISTS is used, so no values
+// are decoded.
+func (l *GeoLocator) CachedSubset(ctx context.Context, ips []string) (cached []string, missing []string, err error) {
+	if l.rcache == nil {
+		return nil, nil, errors.New("CachedSubset: no Redis cache")
+	}
+
+	keys := make([]string, 0, len(ips))
+	seen := make(map[string]bool, len(ips))
+	for _, ip := range ips {
+		key := cacheKey(strings.TrimSpace(ip))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+
+	pipe := l.rcache.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Exists(ctx, l.rcache.prefix+key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	for i, key := range keys {
+		if cmds[i].Val() > 0 {
+			cached = append(cached, key)
+		} else {
+			missing = append(missing, key)
+		}
+	}
+	return cached, missing, nil
+}
+
+// CountBySchemaVersion SCANs the locator's Redis cache and counts its
+// entries by the schema version they were written with, to follow a cache
+// upgrade after a deploy.  Entries from before versioning count as 0.
+// Only the version is decoded.  It stops between pages of the SCAN once
+// ctx is done.
+func (l *GeoLocator) CountBySchemaVersion(ctx context.Context) (map[int]int, error) {
+	if l.rcache == nil {
+		return nil, errors.New("CountBySchemaVersion: no Redis cache")
+	}
+	counts := make(map[int]int)
+	err := l.rcache.scanEntries(ctx, func(vals []string) {
+		for _, v := range vals {
+			var entry struct {
+				Schema int `json:"schema"`
+			}
+			if json.Unmarshal([]byte(v), &entry) == nil {
+				counts[entry.Schema]++
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return counts, nil
+}
+
+// scanEntries SCANs c's IP keys on every shard and calls fn with each
+// page's values, one call at a time.  Keys that aren't IPs under the
+// prefix belong to someone else and are skipped.  It checks ctx between
+// pages.
+func (c *RedisCache) scanEntries(ctx context.Context, fn func(vals []string)) error {
+	var mu sync.Mutex
+	return forEachShard(ctx, c.client, func(ctx context.Context, shard *redis.Client) error {
+		var cursor uint64
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			keys, next, err := shard.Scan(ctx, cursor, scanPattern(c.prefix), 1000).Result()
+			if err != nil {
+				return err
+			}
+			ipKeys := keys[:0]
+			for _, k := range keys {
+				if _, ok := canonicalIP(strings.TrimPrefix(k, c.prefix)); ok {
+					ipKeys = append(ipKeys, k)
+				}
+			}
+			if len(ipKeys) > 0 {
+				res, err := shard.MGet(ctx, ipKeys...).Result()
+				if err != nil {
+					return err
+				}
+				vals := make([]string, 0, len(res))
+				for _, v := range res {
+					if s, ok := v.(string); ok { // nil if expired since the SCAN
+						vals = append(vals, s)
+					}
+				}
+				mu.Lock()
+				fn(vals)
+				mu.Unlock()
+			}
+			if next == 0 {
+				return nil
+			}
+			cursor = next
+		}
+	})
+}
+
+// scanPattern matches the keys under prefix.
+func scanPattern(prefix string) string {
+	var b strings.Builder
+	for _, r := range prefix {
+		if strings.ContainsRune(`*?[]^\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String() + "*"
+}
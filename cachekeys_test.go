@@ -0,0 +1,221 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestCanonicalIP(t *testing.T) {
+	tests := []struct {
+		in, want string
+		ok       bool
+	}{
+		{"8.8.8.8", "8.8.8.8", true},
+		{"::ffff:8.8.8.8", "8.8.8.8", true},
+		{" 8.8.8.8 ", "8.8.8.8", true},
+		{"2001:DB8::1", "2001:db8::1", true},
+		{"2001:0db8:0000:0000:0000:0000:0000:0001", "2001:db8::1", true},
+		{"not-an-ip", "", false},
+		{"8.8.8", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := canonicalIP(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s want: %s %v\ngot: %s %v\n", tt.in, tt.want, tt.ok, got, ok)
+		}
+	}
+}
+
+func TestCompleteness(t *testing.T) {
+	sparse := GeoIPData{IP: "8.8.8.8", ISP: "-----", CountryCode: "--"}
+	full := GeoIPData{IP: "8.8.8.8", ISP: "Google LLC", CountryCode: "US", City: "Mountain View"}
+	if completeness(full) <= completeness(sparse) {
+		t.Errorf("want full > sparse\ngot: %d <= %d\n", completeness(full), completeness(sparse))
+	}
+}
+
+func TestDistinctISPs(t *testing.T) {
+	mr := useMiniredis(t)
+
+	for ip, isp := range map[string]string{
+		"8.8.8.8":     "Google LLC",
+		"8.8.4.4":     "Google LLC",
+		"1.1.1.1":     "Cloudflare, Inc.",
+		"192.168.1.1": "-----",
+	} {
+		geo := GeoIPData{IP: ip, ISP: isp}
+		geo.add2RedisCache(context.Background(), redisClient, time.Hour)
+	}
+	mr.Set("session:abc", `{"isp":"not ours"}`)
+
+	got, err := DistinctISPs(context.Background())
+	if err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+	want := []string{"Cloudflare, Inc.", "Google LLC"}
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %v\ngot: %v\n", want, got)
+	}
+}
+
+func TestCacheKeyIPv6Case(t *testing.T) {
+	mr := useMiniredis(t)
+	useProvider(t, `{"isp":"Google LLC","country_code":"DE","success":true}`)
+
+	first := GetGeoData("2a00:1450:4001:82b::200e")
+	if first.CacheHit {
+		t.Fatalf("first lookup want: miss\ngot: hit\n")
+	}
+	for _, ip := range []string{"2A00:1450:4001:82B::200E", "2a00:1450:4001:082b:0000:0000:0000:200e"} {
+		if geo := GetGeoData(ip); !geo.CacheHit {
+			t.Errorf("%s want: cache hit\ngot: miss\n", ip)
+		}
+	}
+	if keys := mr.Keys(); len(keys) != 1 || keys[0] != "geo:2a00:1450:4001:82b::200e" {
+		t.Errorf("want a single lowercase key\ngot: %v\n", keys)
+	}
+}
+
+func TestCachedSubset(t *testing.T) {
+	mr := useMiniredis(t)
+	mr.Set("geo:8.8.8.8", `{"ip":"8.8.8.8"}`)
+	mr.Set("geo:2001:db8::1", `{"ip":"2001:db8::1"}`)
+
+	in := []string{"::ffff:8.8.8.8", "1.1.1.1", "2001:DB8::1", "8.8.8.8", " 1.1.1.1"}
+	cached, missing, err := CachedSubset(context.Background(), in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"8.8.8.8", "2001:db8::1"}; !reflect.DeepEqual(cached, want) {
+		t.Errorf("want: %v\ngot: %v\n", want, cached)
+	}
+	if want := []string{"1.1.1.1"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("want: %v\ngot: %v\n", want, missing)
+	}
+}
+
+func TestNormalizeCacheKeysPrefix(t *testing.T) {
+	mr := useMiniredis(t)
+	// written before keys were prefixed or canonicalized
+	mr.Set("8.8.8.8", `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US"}`)
+	mr.Set("2001:DB8::1", `{"ip":"2001:DB8::1","isp":"Example"}`)
+	mr.Set("session:abc", `{"isp":"not ours"}`)
+
+	n, err := NormalizeCacheKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("want: 2 merged\ngot: %d\n", n)
+	}
+	want := []string{"geo:2001:db8::1", "geo:8.8.8.8", "session:abc"}
+	if got := mr.Keys(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %v\ngot: %v\n", want, got)
+	}
+	if geo := GetGeoData("8.8.8.8"); !geo.CacheHit || geo.ISP != "Google LLC" {
+		t.Errorf("want: cached Google LLC\ngot: %v %s\n", geo.CacheHit, geo.ISP)
+	}
+}
+
+func TestNormalizeCacheKeysMerge(t *testing.T) {
+	mr := useMiniredis(t)
+	// the same IP cached under its mapped and plain forms
+	mr.Set("geo:::ffff:8.8.8.8", `{"schema":1,"ip":"::ffff:8.8.8.8","isp":"Google LLC","country_code":"US","city":"Mountain View"}`)
+	mr.SetTTL("geo:::ffff:8.8.8.8", 2*time.Hour)
+	mr.Set("geo:8.8.8.8", `{"schema":1,"ip":"8.8.8.8","isp":"Google LLC"}`)
+	mr.SetTTL("geo:8.8.8.8", time.Hour)
+
+	n, err := NormalizeCacheKeys(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"geo:8.8.8.8"}; n != 1 || !reflect.DeepEqual(want, mr.Keys()) {
+		t.Errorf("want: 1 merged into %v\ngot: %d %v\n", want, n, mr.Keys())
+	}
+	geo, ttl, err := readCacheEntry(context.Background(), "geo:8.8.8.8")
+	if err != nil || geo.IP != "8.8.8.8" || geo.City != "Mountain View" || ttl != 2*time.Hour {
+		t.Errorf("want: the more complete entry, 8.8.8.8 Mountain View, longer TTL 2h\ngot: %s %s %s %v\n", geo.IP, geo.City, ttl, err)
+	}
+}
+
+func TestCountBySchemaVersion(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := NewGeoLocator(nil, WithRedisAddr(mr.Addr()))
+	defer l.Close()
+	ctx := context.Background()
+
+	for _, ip := range []string{"8.8.8.8", "8.8.4.4"} {
+		geo := GeoIPData{IP: ip, ISP: "Google LLC"}
+		geo.add2Cache(ctx, l.cache, time.Hour)
+	}
+	mr.Set("geo:1.1.1.1", `{"ip":"1.1.1.1","isp":"Cloudflare, Inc."}`)
+	mr.Set("geo:session", `{"schema":9}`)
+
+	got, err := l.CountBySchemaVersion(ctx)
+	want := map[int]int{0: 1, cacheSchemaVersion: 2}
+	if err != nil || !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %v\ngot: %v %v\n", want, got, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := l.CountBySchemaVersion(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled want: %s\ngot: %v\n", context.Canceled, err)
+	}
+	if _, err := NewGeoLocator(nil, WithCache(NewMemoryCache(10))).CountBySchemaVersion(ctx); err == nil {
+		t.Errorf("no Redis want: an error\ngot: nil\n")
+	}
+}
+
+func TestDistinctISPsLocator(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := NewGeoLocator(nil, WithRedisAddr(mr.Addr()), WithKeyPrefix("app:"))
+	defer l.Close()
+	ctx := context.Background()
+
+	geo := GeoIPData{IP: "8.8.8.8", ISP: "Google LLC"}
+	geo.add2Cache(ctx, l.cache, time.Hour)
+	mr.Set("geo:1.1.1.1", `{"ip":"1.1.1.1","isp":"another locator's"}`)
+
+	got, err := l.DistinctISPs(ctx)
+	if want := []string{"Google LLC"}; err != nil || !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %v\ngot: %v %v\n", want, got, err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := l.DistinctISPs(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled want: %s\ngot: %v\n", context.Canceled, err)
+	}
+	if _, err := NewGeoLocator(nil, WithCache(NewMemoryCache(10))).DistinctISPs(ctx); err == nil {
+		t.Errorf("no Redis want: an error\ngot: nil\n")
+	}
+}
+
+func TestCachedSubsetLocator(t *testing.T) {
+	mr := miniredis.RunT(t)
+	l := NewGeoLocator(nil, WithRedisAddr(mr.Addr()), WithKeyPrefix("app:"))
+	defer l.Close()
+	mr.Set("app:8.8.8.8", `{"ip":"8.8.8.8"}`)
+	mr.Set("geo:1.1.1.1", `{"ip":"1.1.1.1"}`)
+
+	cached, missing, err := l.CachedSubset(context.Background(), []string{"8.8.8.8", "1.1.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"8.8.8.8"}; !reflect.DeepEqual(cached, want) {
+		t.Errorf("want: %v\ngot: %v\n", want, cached)
+	}
+	if want := []string{"1.1.1.1"}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("want: %v\ngot: %v\n", want, missing)
+	}
+	if _, _, err := NewGeoLocator(nil, WithCache(NewMemoryCache(10))).CachedSubset(context.Background(), []string{"8.8.8.8"}); err == nil {
+		t.Errorf("no Redis want: an error\ngot: nil\n")
+	}
+}
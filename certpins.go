@@ -0,0 +1,55 @@
+package me_geolocate
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// ErrCertPinMismatch is returned when the provider's TLS certificate chain
+// doesn't match any pin set with SetProviderCertPins.
+var ErrCertPinMismatch = errors.New("me_geolocate: provider certificate does not match any pin")
+
+// SetProviderCertPins pins the provider's TLS public key.  Each pin is the
+// base64 SHA-256 of a certificate's SubjectPublicKeyInfo (the HPKP format,
+// with or without a "sha256/" prefix).  A connection is only used if some
+// certificate in the chain matches a pin; otherwise the lookup fails with
+// ErrCertPinMismatch.  No pins turns pinning off.  Call it before the
+// first lookup; it isn't safe to call while lookups are running.
+func SetProviderCertPins(pins ...string) {
+	if providerTransport.TLSClientConfig == nil {
+		providerTransport.TLSClientConfig = &tls.Config{}
+	}
+	// pooled connections were verified against the old pins
+	defer providerTransport.CloseIdleConnections()
+
+	if len(pins) == 0 {
+		providerTransport.TLSClientConfig.VerifyPeerCertificate = nil
+		return
+	}
+	pinned := make(map[string]bool, len(pins))
+	for _, p := range pins {
+		pinned[strings.TrimPrefix(p, "sha256/")] = true
+	}
+	providerTransport.TLSClientConfig.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				continue
+			}
+			if pinned[spkiPin(cert)] {
+				return nil
+			}
+		}
+		return ErrCertPinMismatch
+	}
+}
+
+// spkiPin is the pin for cert: base64 SHA-256 of its public key info.
+func spkiPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
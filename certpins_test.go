@@ -0,0 +1,72 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestProviderCertPins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ip":"8.8.8.8","isp":"Google LLC","success":true}`)
+	}))
+	defer srv.Close()
+	defer func(u string) { lookupURL = u }(lookupURL)
+	lookupURL = srv.URL + "/%s"
+
+	// trust the test server's self-signed cert, as a real CA would be
+	oldTLS := providerTransport.TLSClientConfig
+	providerTransport.TLSClientConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	defer func() {
+		providerTransport.TLSClientConfig = oldTLS
+		providerTransport.CloseIdleConnections()
+	}()
+
+	SetProviderCertPins("sha256/" + spkiPin(srv.Certificate()))
+	geo := GeoIPData{IP: "8.8.8.8"}
+	if err := geo.obtainGeoDat(context.Background()); err != nil {
+		t.Errorf("matching pin want: nil\ngot: %s\n", err)
+	}
+
+	SetProviderCertPins("47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+	geo = GeoIPData{IP: "8.8.8.8"}
+	if err := geo.obtainGeoDat(context.Background()); !errors.Is(err, ErrCertPinMismatch) {
+		t.Errorf("wrong pin want: %s\ngot: %v\n", ErrCertPinMismatch, err)
+	}
+
+	SetProviderCertPins()
+	geo = GeoIPData{IP: "8.8.8.8"}
+	if err := geo.obtainGeoDat(context.Background()); err != nil {
+		t.Errorf("no pins want: nil\ngot: %s\n", err)
+	}
+}
+
+func TestSetProviderTLSConfig(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"ip":"8.8.8.8","isp":"Google LLC","success":true}`)
+	}))
+	defer srv.Close()
+	defer func(u string) { lookupURL = u }(lookupURL)
+	lookupURL = srv.URL + "/%s"
+	oldTLS := providerTransport.TLSClientConfig
+	defer func() {
+		providerTransport.TLSClientConfig = oldTLS
+		providerTransport.CloseIdleConnections()
+	}()
+
+	SetProviderCertPins("47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+	SetProviderTLSConfig(srv.Client().Transport.(*http.Transport).TLSClientConfig)
+	geo := GeoIPData{IP: "8.8.8.8"}
+	if err := geo.obtainGeoDat(context.Background()); !errors.Is(err, ErrCertPinMismatch) {
+		t.Errorf("pins kept want: %s\ngot: %v\n", ErrCertPinMismatch, err)
+	}
+
+	SetProviderCertPins()
+	geo = GeoIPData{IP: "8.8.8.8"}
+	if err := geo.obtainGeoDat(context.Background()); err != nil {
+		t.Errorf("test CA trusted want: nil\ngot: %s\n", err)
+	}
+}
@@ -0,0 +1,19 @@
+package me_geolocate
+
+import "sync"
+
+var closeOnce sync.Once
+var closeErr error
+
+// Close shuts down the package's Redis connection.  It is safe to call
+// more than once and from several goroutines: the shutdown runs once and
+// every call returns its result.  Lookups after Close miss the cache.  A
+// client passed to SetRedisClient is left open.
+func Close() error {
+	closeOnce.Do(func() {
+		if redisOwned && redisClient != nil {
+			closeErr = redisClient.Close()
+		}
+	})
+	return closeErr
+}
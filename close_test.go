@@ -0,0 +1,58 @@
+package me_geolocate
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestCloseConcurrent(t *testing.T) {
+	useMiniredis(t)
+	defer func() { closeOnce, closeErr = sync.Once{}, nil }()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = Close()
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != errs[0] {
+			t.Errorf("call %d want: %v\ngot: %v\n", i, errs[0], err)
+		}
+	}
+	if err := Close(); err != errs[0] {
+		t.Errorf("later call want: %v\ngot: %v\n", errs[0], err)
+	}
+}
+
+func TestGeoLocatorClose(t *testing.T) {
+	mr := miniredis.RunT(t)
+	url := providerServer(t, `{"isp":"Google LLC","country_code":"US","success":true}`, nil)
+	l := NewGeoLocator(nil, WithRedisAddr(mr.Addr()), WithLookupURL(url+"/%s"), WithStaleAfter(time.Nanosecond))
+
+	ctx := context.Background()
+	l.GetGeoData(ctx, "8.8.8.8")
+	l.GetGeoData(ctx, "8.8.8.8") // stale, starts a refresh
+	if err := l.Close(); err != nil {
+		t.Errorf("want: nil\ngot: %v\n", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("second Close want: nil\ngot: %v\n", err)
+	}
+	if l.startBackground() {
+		t.Errorf("want: no background work after Close\ngot: started\n")
+	}
+	if err := l.ownsCache.(redis.UniversalClient).Ping(ctx).Err(); err != redis.ErrClosed {
+		t.Errorf("want: %v\ngot: %v\n", redis.ErrClosed, err)
+	}
+}
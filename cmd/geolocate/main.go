@@ -0,0 +1,174 @@
+// Command geolocate looks IPs up and prints where they are.
+//
+//	geolocate [flags] [ip ...]
+//
+// With no IP arguments it reads stdin, taking the first field of each line
+// as the IP, so access logs can be piped straight in.  Lookups go through
+// the cache at REDIS_CONF (or -redis) and the chosen provider.
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pootwaddle/me_geolocate"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("geolocate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	format := fs.String("format", "table", "output format: table, json or csv")
+	redisAddr := fs.String("redis", os.Getenv("REDIS_CONF"), "Redis address, empty for an in-memory cache")
+	provider := fs.String("provider", "geoiplookup.io", "provider: geoiplookup.io, ip-api.com, ipinfo.io or mmdb")
+	token := fs.String("token", os.Getenv("IPINFO_TOKEN"), "ipinfo.io API token")
+	cityDB := fs.String("mmdb", "", "GeoLite2-City database, for -provider mmdb")
+	asnDB := fs.String("mmdb-asn", "", "GeoLite2-ASN database, for -provider mmdb")
+	timeout := fs.Duration("timeout", 10*time.Second, "time allowed per lookup")
+	verbose := fs.Bool("v", false, "log each lookup to stderr")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	out, err := newPrinter(*format, stdout)
+	if err != nil {
+		fmt.Fprintln(stderr, "geolocate:", err)
+		return 2
+	}
+	p, closeProvider, err := newProvider(*provider, *token, *cityDB, *asnDB)
+	if err != nil {
+		fmt.Fprintln(stderr, "geolocate:", err)
+		return 2
+	}
+	defer closeProvider()
+
+	level := slog.LevelWarn
+	if *verbose {
+		level = slog.LevelInfo
+	}
+	logger := slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: level}))
+	opts := []me_geolocate.Option{me_geolocate.WithProvider(p), me_geolocate.WithRedisAddr(*redisAddr)}
+	if *redisAddr == "" {
+		opts = append(opts, me_geolocate.WithCache(me_geolocate.NewMemoryCache(10000)))
+	}
+	l := me_geolocate.NewGeoLocator(logger, opts...)
+	defer l.Close()
+
+	lookup := func(ip string) error {
+		ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+		defer cancel()
+		geo, _ := l.GetGeoData(ctx, ip)
+		return out.print(geo)
+	}
+
+	status := 0
+	if fs.NArg() > 0 {
+		for _, ip := range fs.Args() {
+			if err := lookup(ip); err != nil {
+				fmt.Fprintln(stderr, "geolocate:", err)
+				return 1
+			}
+		}
+	} else {
+		sc := bufio.NewScanner(stdin)
+		for sc.Scan() {
+			fields := strings.Fields(sc.Text())
+			if len(fields) == 0 {
+				continue
+			}
+			if err := lookup(fields[0]); err != nil {
+				fmt.Fprintln(stderr, "geolocate:", err)
+				return 1
+			}
+		}
+		if err := sc.Err(); err != nil {
+			fmt.Fprintln(stderr, "geolocate:", err)
+			status = 1
+		}
+	}
+	if err := out.flush(); err != nil {
+		fmt.Fprintln(stderr, "geolocate:", err)
+		status = 1
+	}
+	return status
+}
+
+func newProvider(name, token, cityDB, asnDB string) (me_geolocate.Provider, func(), error) {
+	switch name {
+	case "geoiplookup.io":
+		return &me_geolocate.GeoIPLookupProvider{}, func() {}, nil
+	case "ip-api.com":
+		return &me_geolocate.IPAPIProvider{}, func() {}, nil
+	case "ipinfo.io":
+		return &me_geolocate.IPInfoProvider{Token: token}, func() {}, nil
+	case "mmdb":
+		if cityDB == "" {
+			return nil, nil, fmt.Errorf("-provider mmdb needs -mmdb")
+		}
+		p, err := me_geolocate.NewMMDBProvider(cityDB, asnDB, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		return p, func() { p.Close() }, nil
+	}
+	return nil, nil, fmt.Errorf("unknown provider %q", name)
+}
+
+// printer writes results in one of the output formats.  json and csv rows
+// go out as they're looked up so long inputs stream; a table is held until
+// flush, since its columns are sized to fit every row.
+type printer struct {
+	print func(me_geolocate.GeoIPData) error
+	flush func() error
+}
+
+func newPrinter(format string, w io.Writer) (printer, error) {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "IP\tCOUNTRY\tREGION\tCITY\tISP\tASN\tPROVIDER\tERROR")
+		return printer{
+			print: func(g me_geolocate.GeoIPData) error {
+				_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+					g.IP, g.CountryCode, g.Region, g.City, g.ISP, g.Asn, g.Provider, g.Error)
+				return err
+			},
+			flush: tw.Flush,
+		}, nil
+	case "json":
+		enc := json.NewEncoder(w)
+		return printer{
+			print: func(g me_geolocate.GeoIPData) error { return enc.Encode(g) },
+			flush: func() error { return nil },
+		}, nil
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(me_geolocate.CSVHeader()); err != nil {
+			return printer{}, err
+		}
+		return printer{
+			print: func(g me_geolocate.GeoIPData) error {
+				if err := cw.Write(g.CSVRecord()); err != nil {
+					return err
+				}
+				cw.Flush()
+				return cw.Error()
+			},
+			flush: func() error { cw.Flush(); return cw.Error() },
+		}, nil
+	}
+	return printer{}, fmt.Errorf("unknown format %q", format)
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/pootwaddle/me_geolocate"
+)
+
+func TestRunJSON(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-redis", "", "-format", "json", "10.0.0.1"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("want: exit 0\ngot: %d %s\n", code, stderr.String())
+	}
+	var geo me_geolocate.GeoIPData
+	if err := json.Unmarshal(stdout.Bytes(), &geo); err != nil {
+		t.Fatal(err)
+	}
+	if geo.IP != "10.0.0.1" || geo.Provider != "non-routable" {
+		t.Errorf("want: 10.0.0.1 non-routable\ngot: %s %s\n", geo.IP, geo.Provider)
+	}
+}
+
+func TestRunStdinCSV(t *testing.T) {
+	log := `10.0.0.1 - - [15/Oct/2026:10:00:00 +0000] "GET / HTTP/1.1" 200 512
+
+192.168.1.7 - - [15/Oct/2026:10:00:01 +0000] "GET /x HTTP/1.1" 404 0
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-redis", "", "-format", "csv"}, strings.NewReader(log), &stdout, &stderr); code != 0 {
+		t.Fatalf("want: exit 0\ngot: %d %s\n", code, stderr.String())
+	}
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ip,") ||
+		!strings.HasPrefix(lines[1], "10.0.0.1,") || !strings.HasPrefix(lines[2], "192.168.1.7,") {
+		t.Errorf("want: header and 2 rows\ngot: %s\n", stdout.String())
+	}
+}
+
+func TestRunTable(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"-redis", "", "10.0.0.1"}, nil, &stdout, &stderr); code != 0 {
+		t.Fatalf("want: exit 0\ngot: %d %s\n", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "IP ") || !strings.Contains(stdout.String(), "10.0.0.1") {
+		t.Errorf("want: a table with 10.0.0.1\ngot: %s\n", stdout.String())
+	}
+}
+
+func TestRunBadFlags(t *testing.T) {
+	for _, args := range [][]string{{"-format", "xml"}, {"-provider", "nope"}, {"-provider", "mmdb"}} {
+		var stdout, stderr bytes.Buffer
+		if code := run(args, nil, &stdout, &stderr); code != 2 {
+			t.Errorf("want: exit 2 for %v\ngot: %d\n", args, code)
+		}
+	}
+}
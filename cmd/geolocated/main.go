@@ -0,0 +1,57 @@
+// Command geolocated serves lookups over HTTP, see me_geolocate.Server.
+//
+//	geolocated [-addr :8080]
+//
+// The cache comes from REDIS_CONF as for the package.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pootwaddle/me_geolocate"
+)
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	flag.Parse()
+
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	l := me_geolocate.NewGeoLocator(logger)
+	defer l.Close()
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           me_geolocate.NewServer(l),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	// ListenAndServe returns as soon as Shutdown starts, so wait for the
+	// drain to finish before closing the locator
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdown); err != nil {
+			logger.Error("geolocated shutdown", "err", err)
+		}
+	}()
+
+	logger.Info("geolocated listening", "addr", *addr)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("geolocated stopped", "err", err)
+		l.Close()
+		os.Exit(1)
+	}
+	<-drained
+}
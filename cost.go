@@ -0,0 +1,59 @@
+package me_geolocate
+
+import "context"
+
+// EstimateCost works out, without calling the provider, how many provider
+// lookups a batch of ips would need and what they'd cost at perCall each,
+// see GeoLocator.EstimateCost.
+func EstimateCost(ctx context.Context, ips []string, perCall float64) (misses int, cost float64, err error) {
+	return std().EstimateCost(ctx, ips, perCall)
+}
+
+// EstimateCost works out, without calling the provider, how many provider
+// lookups GetGeoDataBatch(ctx, ips) would need and what they'd cost at
+// perCall each.  Duplicates are counted once; invalid, test, overridden,
+// local, non-routable and already cached IPs are free.  Only the cache is
+// read, in one round trip if it supports that.  With no cache the error is
+// ErrNoCache, as GetGeoData never reaches the provider without one.
+func (l *GeoLocator) EstimateCost(ctx context.Context, ips []string, perCall float64) (misses int, cost float64, err error) {
+	if l.cache == nil {
+		return 0, 0, ErrNoCache
+	}
+
+	seen := make(map[string]bool, len(ips))
+	var keys []string
+	for _, ip := range ips {
+		if l.testIP != "" && ip == l.testIP {
+			continue
+		}
+		if _, ok := matchOverride(l.overrides, ip); ok {
+			continue
+		}
+		geo := newGeoIPData(ip)
+		if _, ok := parseAddr(geo.IP); !ok {
+			continue // GetGeoData turns it away
+		}
+		key := cacheKey(geo.IP)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		if geo.isLocalIn(l.localNets) || !geo.isRoutable() {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return 0, 0, nil
+	}
+
+	cached := l.getMulti(ctx, keys)
+	for _, key := range keys {
+		geo, ok := cached[key]
+		if ok && !l.tooCoarse(geo) && (!placeholderCountry(geo.CountryCode) || geo.Provider == providerNegative) {
+			continue
+		}
+		misses++
+	}
+	return misses, float64(misses) * perCall, ctx.Err()
+}
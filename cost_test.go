@@ -0,0 +1,34 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEstimateCost(t *testing.T) {
+	mr := useMiniredis(t)
+	mr.Set("geo:9.9.9.9", `{"ip":"9.9.9.9","isp":"Quad9","country_code":"CH","success":true}`)
+	mr.Set("geo:1.0.0.1", `{"ip":"1.0.0.1","country_code":"--","success":true}`)
+	ctx := context.Background()
+
+	ips := []string{"8.8.8.8", "8.8.8.8", "::ffff:8.8.8.8", "9.9.9.9", "10.0.0.1", "127.0.0.1", "1.0.0.1", "1.1.1.1", "not-an-ip", "999.1.1.1"}
+	misses, cost, err := EstimateCost(ctx, ips, 0.5)
+	if err != nil || misses != 3 || cost != 1.5 {
+		t.Errorf("want: 3 misses, 1.5\ngot: %d %v %v\n", misses, cost, err)
+	}
+
+	// the locator's own cache, and overrides are free
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithOverridesFile(writeOverrides(t, `{"8.8.8.0/24": {"country_code": "US"}}`)))
+	defer l.Close()
+	geo := GeoIPData{IP: "1.1.1.1", CountryCode: "AU"}
+	geo.add2Cache(ctx, l.cache, 0)
+	if misses, _, err := l.EstimateCost(ctx, []string{"8.8.8.8", "1.1.1.1", "9.9.9.9"}, 1); err != nil || misses != 1 {
+		t.Errorf("locator want: 1 miss\ngot: %d %v\n", misses, err)
+	}
+
+	redis_addr = ""
+	if _, _, err := EstimateCost(ctx, ips, 0.5); !errors.Is(err, ErrNoCache) {
+		t.Errorf("no cache want: %s\ngot: %v\n", ErrNoCache, err)
+	}
+}
@@ -0,0 +1,67 @@
+package me_geolocate
+
+import "context"
+
+// WithCountryOnly asks providers for the country alone, for callers who
+// only need that and pay their provider less for it.  Providers with a
+// cheaper country lookup (see CountryProvider) use it; others are asked as
+// usual.  Either way everything past the country and continent is dropped
+// before caching, and the answer has CountryOnly set so an empty City
+// isn't mistaken for missing data.  A locator without the option treats a
+// country-only cache entry as a miss; one with it is happy with a full one.
+func WithCountryOnly(on bool) Option {
+	return func(l *GeoLocator) { l.countryOnly = on }
+}
+
+// CountryProvider is a Provider with a cheaper lookup that only fills in
+// the country, used by WithCountryOnly.  IPAPIProvider and IPInfoProvider
+// are CountryProviders.
+type CountryProvider interface {
+	Provider
+	LookupCountry(ctx context.Context, geo *GeoIPData) error
+}
+
+// countryScoped is p, cut down to the country if WithCountryOnly is set.
+func (l *GeoLocator) countryScoped(p Provider) Provider {
+	if !l.countryOnly {
+		return p
+	}
+	return &countryOnlyProvider{Provider: p}
+}
+
+// tooCoarse reports whether cached is a country-only answer and l wants
+// the full record, so the IP has to be looked up again.
+func (l *GeoLocator) tooCoarse(cached GeoIPData) bool {
+	return cached.CountryOnly && !l.countryOnly
+}
+
+// countryOnlyProvider asks Provider for the country, the cheap way if it
+// has one, and keeps nothing else.
+type countryOnlyProvider struct {
+	Provider
+}
+
+func (p *countryOnlyProvider) Lookup(ctx context.Context, geo *GeoIPData) error {
+	var err error
+	if cp, ok := p.Provider.(CountryProvider); ok {
+		err = cp.LookupCountry(ctx, geo)
+	} else {
+		err = p.Provider.Lookup(ctx, geo)
+	}
+	if err != nil {
+		return err
+	}
+	geo.keepCountry()
+	return nil
+}
+
+// keepCountry clears everything a provider answered past the country and
+// continent.
+func (g *GeoIPData) keepCountry() {
+	g.ISP, g.Org, g.Hostname = "", "", ""
+	g.Latitude, g.Longitude = 0, 0
+	g.PostalCode, g.City, g.Region, g.District = "", "", "", ""
+	g.TimezoneName, g.ConnectionType = "", ""
+	g.AsnNumber, g.AsnOrg, g.Asn = 0, "", ""
+	g.CurrencyCode, g.CurrencyName = "", ""
+}
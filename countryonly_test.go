@@ -0,0 +1,78 @@
+package me_geolocate
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestWithCountryOnly(t *testing.T) {
+	var path atomic.Value
+	url := providerServer(t, `{"status":"success","continent":"North America","continentCode":"NA","country":"United States","countryCode":"US","city":"Mountain View","lat":37.422,"lon":-122.085,"isp":"Google LLC"}`, func(r *http.Request) {
+		path.Store(r.URL.Path)
+	})
+	cache := NewMemoryCache(10)
+	ctx := context.Background()
+
+	l := NewGeoLocator(nil, WithCache(cache), WithCountryOnly(true),
+		WithProvider(&IPAPIProvider{URL: url + "/full/%s", CountryURL: url + "/country/%s"}))
+	defer l.Close()
+	geo, err := l.GetGeoData(ctx, "8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := path.Load(); p != "/country/8.8.8.8" {
+		t.Errorf("want: the country endpoint\ngot: %v\n", p)
+	}
+	if !geo.CountryOnly || geo.CountryCode != "US" || geo.ContinentCode != "NA" || geo.City != "" || geo.ISP != "" || geo.Latitude != 0 {
+		t.Errorf("want: country only, US NA\ngot: %+v\n", geo)
+	}
+	if geo, _ := l.GetGeoData(ctx, "8.8.8.8"); !geo.CacheHit || !geo.CountryOnly {
+		t.Errorf("want: a country-only cache hit\ngot: %t %t\n", geo.CacheHit, geo.CountryOnly)
+	}
+
+	// a full locator on the same cache looks it up again
+	full := NewGeoLocator(nil, WithCache(cache), WithProvider(&IPAPIProvider{URL: url + "/full/%s"}))
+	defer full.Close()
+	geo, err = full.GetGeoData(ctx, "8.8.8.8")
+	if err != nil || geo.CacheHit || geo.CountryOnly || geo.City != "Mountain View" {
+		t.Errorf("full want: a fresh Mountain View\ngot: %t %t %s %v\n", geo.CacheHit, geo.CountryOnly, geo.City, err)
+	}
+	if p := path.Load(); p != "/full/8.8.8.8" {
+		t.Errorf("want: the full endpoint\ngot: %v\n", p)
+	}
+	// and a country-only one is happy with the full entry
+	if geo, _ := l.GetGeoData(ctx, "8.8.8.8"); !geo.CacheHit || geo.City != "Mountain View" {
+		t.Errorf("want: the full cache hit\ngot: %t %s\n", geo.CacheHit, geo.City)
+	}
+}
+
+func TestWithCountryOnlyIPInfo(t *testing.T) {
+	url := providerServer(t, "US\n", func(r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, "/country") {
+			t.Errorf("want: the country endpoint\ngot: %s\n", r.URL.Path)
+		}
+	})
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithCountryOnly(true),
+		WithProvider(&IPInfoProvider{URL: url + "/%s/json", CountryURL: url + "/%s/country"}))
+	defer l.Close()
+
+	geo, err := l.GetGeoData(context.Background(), "8.8.8.8")
+	if err != nil || geo.CountryCode != "US" || !geo.CountryOnly || geo.Provider != "ipinfo.io" {
+		t.Errorf("want: US country only from ipinfo.io\ngot: %s %t %s %v\n", geo.CountryCode, geo.CountryOnly, geo.Provider, err)
+	}
+}
+
+func TestWithCountryOnlyFullProvider(t *testing.T) {
+	useProvider(t, `{"isp":"Google LLC","country_code":"US","city":"Mountain View","latitude":37.4,"longitude":-122.1,"success":true}`)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithCountryOnly(true))
+	defer l.Close()
+
+	// geoiplookup.io has no country endpoint, so only the answer is cut down
+	geo, err := l.GetGeoData(context.Background(), "8.8.8.8")
+	if err != nil || geo.CountryCode != "US" || !geo.CountryOnly || geo.City != "" || geo.ISP != "" || geo.Latitude != 0 {
+		t.Errorf("want: US country only\ngot: %+v %v\n", geo, err)
+	}
+}
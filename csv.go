@@ -0,0 +1,76 @@
+package me_geolocate
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strconv"
+)
+
+var csvHeader = []string{
+	"ip", "isp", "org", "city", "region", "country_code", "country_name",
+	"latitude", "longitude", "asn", "provider", "cache_hit", "error",
+}
+
+// csvChunk is how many IPs BatchToCSV looks up, and writes, at a time.
+const csvChunk = 100
+
+// BatchToCSV looks ips up and writes the results to w as CSV, see
+// GeoLocator.BatchToCSV.
+func BatchToCSV(ctx context.Context, ips []string, w io.Writer) error {
+	return std().BatchToCSV(ctx, ips, w)
+}
+
+// BatchToCSV looks ips up with GetGeoDataBatch, 100 at a time, and writes
+// each chunk's results to w as CSV rows, flushed, before starting the
+// next, so very long input lists don't have to fit in memory.  A header
+// row comes first; a failed lookup still gets its row, with the reason in
+// the error column.  If ctx is done, or a chunk fails as a whole (e.g.
+// ErrNoCache), the rows written so far stay and its error is returned.
+func (l *GeoLocator) BatchToCSV(ctx context.Context, ips []string, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(csvHeader); err != nil {
+		return err
+	}
+	for start := 0; start < len(ips); start += csvChunk {
+		results, err := l.GetGeoDataBatch(ctx, ips[start:min(start+csvChunk, len(ips))])
+		if err != nil {
+			cw.Flush() // the header, at least
+			return err
+		}
+		for _, geo := range results {
+			if err := cw.Write(geo.CSVRecord()); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		if err := cw.Error(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CSVHeader is the header row BatchToCSV writes, naming CSVRecord's columns.
+func CSVHeader() []string {
+	return append([]string(nil), csvHeader...)
+}
+
+// CSVRecord is geo as a BatchToCSV row.
+func (geo GeoIPData) CSVRecord() []string {
+	return []string{
+		geo.IP,
+		geo.ISP,
+		geo.Org,
+		geo.City,
+		geo.Region,
+		geo.CountryCode,
+		geo.CountryName,
+		strconv.FormatFloat(geo.Latitude, 'f', -1, 64),
+		strconv.FormatFloat(geo.Longitude, 'f', -1, 64),
+		geo.Asn,
+		geo.Provider,
+		strconv.FormatBool(geo.CacheHit),
+		geo.Error,
+	}
+}
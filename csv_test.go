@@ -0,0 +1,66 @@
+package me_geolocate
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestBatchToCSV(t *testing.T) {
+	useMiniredis(t)
+	useProvider(t, `{"isp":"Google LLC","city":"Mountain View","country_code":"US","latitude":37.422,"longitude":-122.085,"success":true}`)
+
+	var buf bytes.Buffer
+	if err := BatchToCSV(context.Background(), []string{"8.8.8.8", "10.1.1.1", "8.8.4.4"}, &buf); err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("want: header + 3 rows\ngot: %d rows\n", len(rows))
+	}
+	if rows[0][0] != "ip" || rows[0][len(rows[0])-1] != "error" {
+		t.Errorf("want header row\ngot: %v\n", rows[0])
+	}
+	if rows[1][0] != "8.8.8.8" || rows[1][1] != "Google LLC" || rows[1][7] != "37.422" {
+		t.Errorf("want 8.8.8.8 Google LLC 37.422\ngot: %v\n", rows[1])
+	}
+	if rows[2][12] != "Invalid public IPv4 or IPv6 address" {
+		t.Errorf("want the error column filled\ngot: %v\n", rows[2])
+	}
+}
+
+func TestBatchToCSVChunks(t *testing.T) {
+	useProvider(t, `{"isp":"Google LLC","country_code":"US","success":true}`)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(1000)), WithLookupURL(lookupURL))
+	defer l.Close()
+
+	ips := make([]string, csvChunk+5)
+	for i := range ips {
+		ips[i] = fmt.Sprintf("8.8.%d.%d", i/250, i%250+1)
+	}
+	var buf bytes.Buffer
+	if err := l.BatchToCSV(context.Background(), ips, &buf); err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+	rows, _ := csv.NewReader(&buf).ReadAll()
+	if len(rows) != len(ips)+1 || rows[len(ips)][0] != ips[len(ips)-1] {
+		t.Errorf("want: header + %d rows in order\ngot: %d rows\n", len(ips), len(rows))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	buf.Reset()
+	if err := l.BatchToCSV(ctx, ips, &buf); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled want: %s\ngot: %v\n", context.Canceled, err)
+	}
+	if rows, _ := csv.NewReader(&buf).ReadAll(); len(rows) != 1 {
+		t.Errorf("cancelled want: just the header\ngot: %d rows\n", len(rows))
+	}
+}
@@ -0,0 +1,199 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/romana/rlog"
+)
+
+// ErrCacheUnavailable is returned by cache management calls while the
+// cache is bypassed, see SetCacheFailover.
+var ErrCacheUnavailable = errors.New("me_geolocate: cache unavailable")
+
+var stdCacheHealth = newCacheHealth(5, 30*time.Second)
+
+// Health is the state of a locator's dependencies, see GeoLocator.Health.
+type Health struct {
+	Cache         string    `json:"cache"` // "ok", "degraded" or "none"
+	DegradedSince time.Time `json:"degraded_since,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+
+	// Providers is each provider's circuit state, "closed", "open" or
+	// "half-open", if WithCircuitBreaker is set.
+	Providers map[string]string `json:"providers,omitempty"`
+}
+
+// SetCacheFailover sets when the package-level cache is bypassed: after
+// failures errors in a row lookups go straight to the provider, and every
+// retry one cache call is let through to see if it is back.  A failures
+// of 0 never bypasses it.  The default is 5 and 30s.
+func SetCacheFailover(failures int, retry time.Duration) {
+	stdCacheHealth.mu.Lock()
+	defer stdCacheHealth.mu.Unlock()
+	stdCacheHealth.threshold, stdCacheHealth.retry = failures, retry
+}
+
+// WithCacheFailover is SetCacheFailover for this locator.
+func WithCacheFailover(failures int, retry time.Duration) Option {
+	return func(l *GeoLocator) { l.cacheHealth = newCacheHealth(failures, retry) }
+}
+
+// GetHealth reports whether the package-level cache is in use.
+func GetHealth() Health {
+	return std().Health()
+}
+
+// Health reports whether the locator's cache is in use or bypassed, and
+// which providers are being called.
+func (l *GeoLocator) Health() Health {
+	h := Health{Cache: "none"}
+	if l.cache != nil {
+		h = l.cacheHealth.health()
+	}
+	for i, b := range l.breakers {
+		if b == nil {
+			continue
+		}
+		if h.Providers == nil {
+			h.Providers = make(map[string]string)
+		}
+		h.Providers[l.providers[i].Name()] = b.current()
+	}
+	return h
+}
+
+// cacheHealth counts a cache's failures, see degradingCache.
+type cacheHealth struct {
+	mu        sync.Mutex
+	threshold int
+	retry     time.Duration
+	failures  int
+	since     time.Time // zero = healthy
+	probeAt   time.Time
+	lastErr   error
+}
+
+func newCacheHealth(failures int, retry time.Duration) *cacheHealth {
+	return &cacheHealth{threshold: failures, retry: retry}
+}
+
+func (h *cacheHealth) health() Health {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.since.IsZero() {
+		return Health{Cache: "ok"}
+	}
+	return Health{Cache: "degraded", DegradedSince: h.since, LastError: h.lastErr.Error()}
+}
+
+// allow is whether to call the cache: always when healthy, once per retry
+// interval when degraded.
+func (h *cacheHealth) allow() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.since.IsZero() {
+		return true
+	}
+	now := time.Now()
+	if now.Before(h.probeAt) {
+		return false
+	}
+	h.probeAt = now.Add(h.retry)
+	return true
+}
+
+func (h *cacheHealth) record(err error) {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		// the caller gave up, which says nothing either way
+		return
+	}
+	if errors.Is(err, ErrCacheMiss) {
+		// the cache answered
+		err = nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		if !h.since.IsZero() {
+			rlog.Infof("Cache is back after %s", time.Since(h.since).Round(time.Second))
+		}
+		h.failures, h.since = 0, time.Time{}
+		return
+	}
+	h.lastErr = err
+	h.failures++
+	if h.since.IsZero() && h.threshold > 0 && h.failures >= h.threshold {
+		h.since = time.Now()
+		h.probeAt = h.since.Add(h.retry)
+		rlog.Errorf("Cache failed %d times in a row, bypassing it - %s", h.failures, err)
+	}
+}
+
+// degradingCache stops calling a failing cache, so lookups are served
+// from the provider alone instead of each waiting on, and logging, a
+// cache error.  While bypassed, Get misses and Set and Delete return
+// ErrCacheUnavailable.
+type degradingCache struct {
+	Cache
+	health *cacheHealth
+}
+
+func (c *degradingCache) Get(ctx context.Context, key string) (GeoIPData, error) {
+	if !c.health.allow() {
+		return GeoIPData{}, ErrCacheMiss
+	}
+	geo, err := c.Cache.Get(ctx, key)
+	c.health.record(err)
+	return geo, err
+}
+
+func (c *degradingCache) Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error {
+	if !c.health.allow() {
+		return ErrCacheUnavailable
+	}
+	err := c.Cache.Set(ctx, key, geo, ttl)
+	c.health.record(err)
+	return err
+}
+
+func (c *degradingCache) Delete(ctx context.Context, key string) error {
+	if !c.health.allow() {
+		return ErrCacheUnavailable
+	}
+	err := c.Cache.Delete(ctx, key)
+	c.health.record(err)
+	return err
+}
+
+func (c *degradingCache) ttl(ctx context.Context, key string) (time.Duration, error) {
+	if !c.health.allow() {
+		return 0, ErrCacheUnavailable
+	}
+	ttl, err := remainingTTL(ctx, c.Cache, key)
+	c.health.record(err)
+	return ttl, err
+}
+
+func (c *degradingCache) GetMulti(ctx context.Context, keys []string) (map[string]GeoIPData, error) {
+	if !c.health.allow() {
+		return map[string]GeoIPData{}, nil
+	}
+	mg, ok := c.Cache.(multiGetter)
+	if !ok {
+		found := make(map[string]GeoIPData, len(keys))
+		for _, key := range keys {
+			geo, err := c.Cache.Get(ctx, key)
+			c.health.record(err)
+			if err == nil {
+				found[key] = geo
+			}
+		}
+		return found, nil
+	}
+	found, err := mg.GetMulti(ctx, keys)
+	c.health.record(err)
+	return found, err
+}
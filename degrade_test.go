@@ -0,0 +1,101 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestCacheFailover(t *testing.T) {
+	mr := miniredis.RunT(t)
+	url := providerServer(t, `{"isp":"Google LLC","country_code":"US","success":true}`, nil)
+	l := NewGeoLocator(nil, WithRedisAddr(mr.Addr()), WithLookupURL(url+"/%s"), WithCacheFailover(2, 50*time.Millisecond))
+	defer l.Close()
+	ctx := context.Background()
+
+	if h := l.Health(); h.Cache != "ok" {
+		t.Errorf("want: ok\ngot: %+v\n", h)
+	}
+
+	addr := mr.Addr()
+	mr.Close()
+	geo, err := l.GetGeoData(ctx, "8.8.8.8")
+	if err != nil || geo.ISP != "Google LLC" {
+		t.Errorf("want: answered by the provider with Redis down\ngot: %s %v\n", geo.ISP, err)
+	}
+	if h := l.Health(); h.Cache != "degraded" || h.LastError == "" {
+		t.Errorf("want: degraded after a failed get and set\ngot: %+v\n", h)
+	}
+	if err := l.Invalidate(ctx, "8.8.8.8"); err != ErrCacheUnavailable {
+		t.Errorf("want: ErrCacheUnavailable\ngot: %v\n", err)
+	}
+
+	if err := mr.StartAddr(addr); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	l.GetGeoData(ctx, "8.8.8.8")
+	if h := l.Health(); h.Cache != "ok" {
+		t.Errorf("want: ok once Redis answers a probe\ngot: %+v\n", h)
+	}
+}
+
+func TestHealthNoCache(t *testing.T) {
+	l := NewGeoLocator(nil, WithRedisAddr(""))
+	defer l.Close()
+	if h := l.Health(); h.Cache != "none" {
+		t.Errorf("want: none\ngot: %+v\n", h)
+	}
+}
+
+// blockingCache fails with failErr, or if that is nil hangs until the
+// caller gives up, like a partitioned Redis.
+type blockingCache struct{ failErr error }
+
+func (c *blockingCache) Get(ctx context.Context, key string) (GeoIPData, error) {
+	if c.failErr != nil {
+		return GeoIPData{}, c.failErr
+	}
+	<-ctx.Done()
+	return GeoIPData{}, ctx.Err()
+}
+
+func (c *blockingCache) Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error {
+	_, err := c.Get(ctx, key)
+	return err
+}
+
+func (c *blockingCache) Delete(ctx context.Context, key string) error {
+	_, err := c.Get(ctx, key)
+	return err
+}
+
+func TestCacheFailoverTimeouts(t *testing.T) {
+	bc := &blockingCache{failErr: errors.New("connection refused")}
+	c := &degradingCache{Cache: bc, health: newCacheHealth(2, 20*time.Millisecond)}
+	timeout := func() {
+		bc.failErr = nil
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+		defer cancel()
+		c.Get(ctx, "8.8.8.8")
+		bc.failErr = errors.New("connection refused")
+	}
+
+	// a caller timing out between failures doesn't reset the count
+	c.Get(context.Background(), "8.8.8.8")
+	timeout()
+	c.Get(context.Background(), "8.8.8.8")
+	if h := c.health.health(); h.Cache != "degraded" {
+		t.Errorf("want: degraded\ngot: %+v\n", h)
+	}
+
+	// nor does a probe that times out bring the cache back
+	time.Sleep(30 * time.Millisecond)
+	timeout()
+	if h := c.health.health(); h.Cache != "degraded" {
+		t.Errorf("want: still degraded after a timed out probe\ngot: %+v\n", h)
+	}
+}
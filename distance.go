@@ -0,0 +1,82 @@
+package me_geolocate
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+const earthRadiusKm = 6371.0
+
+var coordinatePrecision = -1 // decimals, see SetCoordinatePrecision
+
+// SetCoordinatePrecision rounds provider coordinates to decimals places
+// before they are cached, e.g. 2 is roughly 1km.  This deliberately throws
+// precision away, for privacy and so nearby lookups share coordinates; it
+// can't be undone for entries already cached.  A negative value (the
+// default) keeps full precision.
+func SetCoordinatePrecision(decimals int) {
+	coordinatePrecision = decimals
+}
+
+func (g *GeoIPData) roundCoordinates() {
+	if coordinatePrecision < 0 {
+		return
+	}
+	scale := math.Pow(10, float64(coordinatePrecision))
+	g.Latitude = math.Round(g.Latitude*scale) / scale
+	g.Longitude = math.Round(g.Longitude*scale) / scale
+}
+
+// haversineKm is the great-circle distance between two points in km.
+func haversineKm(lat1, lon1, lat2, lon2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLon := (lon2 - lon1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(a))
+}
+
+// hasCoordinates reports whether geo carries a real location.  0,0 is in
+// the Gulf of Guinea and is what we get when nothing was located.
+func (geo GeoIPData) hasCoordinates() bool {
+	return geo.Located && (geo.Latitude != 0 || geo.Longitude != 0)
+}
+
+// SortByDistance looks up ips and returns the results nearest first from
+// refLat,refLon, see GeoLocator.SortByDistance.
+func SortByDistance(ctx context.Context, ips []string, refLat, refLon float64) ([]GeoIPData, error) {
+	return std().SortByDistance(ctx, ips, refLat, refLon)
+}
+
+// SortByDistance looks up ips with GetGeoDataBatch and returns the results
+// nearest first from refLat,refLon.  Results without coordinates go last,
+// in input order.  The error is the batch's; the results are sorted
+// either way.
+func (l *GeoLocator) SortByDistance(ctx context.Context, ips []string, refLat, refLon float64) ([]GeoIPData, error) {
+	geos, err := l.GetGeoDataBatch(ctx, ips)
+	sortByDistance(geos, refLat, refLon)
+	return geos, err
+}
+
+func sortByDistance(geos []GeoIPData, refLat, refLon float64) {
+	type ranked struct {
+		geo GeoIPData
+		km  float64
+	}
+	r := make([]ranked, len(geos))
+	for i, geo := range geos {
+		km := math.Inf(1)
+		if geo.hasCoordinates() {
+			km = haversineKm(refLat, refLon, geo.Latitude, geo.Longitude)
+		}
+		r[i] = ranked{geo, km}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].km < r[j].km
+	})
+	for i := range r {
+		geos[i] = r[i].geo
+	}
+}
@@ -0,0 +1,89 @@
+package me_geolocate
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHaversineKm(t *testing.T) {
+	// Dallas to Austin is about 292 km as the crow flies
+	got := haversineKm(32.7767, -96.7970, 30.2672, -97.7431)
+	if math.Abs(got-292) > 3 {
+		t.Errorf("want: ~292\ngot: %f\n", got)
+	}
+	if got := haversineKm(33, -97, 33, -97); got != 0 {
+		t.Errorf("want: 0\ngot: %f\n", got)
+	}
+}
+
+func TestSortByDistance(t *testing.T) {
+	geos := []GeoIPData{
+		{IP: "1", Located: false},
+		{IP: "london", Located: true, Latitude: 51.5074, Longitude: -0.1278},
+		{IP: "plano", Located: true, Latitude: 33.02, Longitude: -96.6988},
+		{IP: "2", Located: true},
+		{IP: "tokyo", Located: true, Latitude: 35.6762, Longitude: 139.6503},
+	}
+
+	// from Lewisville
+	sortByDistance(geos, 33.0, -97.0)
+
+	want := []string{"plano", "london", "tokyo", "1", "2"}
+	for i, w := range want {
+		if geos[i].IP != w {
+			t.Errorf("position %d want: %s\ngot: %s\n", i, w, geos[i].IP)
+		}
+	}
+}
+
+func TestSortByDistanceLookup(t *testing.T) {
+	coords := map[string]string{
+		"8.8.8.8": `"latitude":51.5074,"longitude":-0.1278`, // London
+		"1.1.1.1": `"latitude":33.02,"longitude":-96.6988`,  // Plano
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		fmt.Fprintf(w, `{"isp":"ISP","country_code":"US",%s,"success":true}`, coords[ip])
+	}))
+	defer srv.Close()
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"))
+	defer l.Close()
+
+	geos, err := l.SortByDistance(context.Background(), []string{"10.0.0.1", "8.8.8.8", "1.1.1.1"}, 33.0, -97.0)
+	if err != nil || len(geos) != 3 {
+		t.Fatalf("want: 3 results\ngot: %d %v\n", len(geos), err)
+	}
+	want := []string{"1.1.1.1", "8.8.8.8", "10.0.0.1"}
+	for i, w := range want {
+		if geos[i].IP != w {
+			t.Errorf("position %d want: %s\ngot: %s\n", i, w, geos[i].IP)
+		}
+	}
+}
+
+func TestSetCoordinatePrecision(t *testing.T) {
+	geo := GeoIPData{Latitude: 33.0198, Longitude: -96.69884}
+	geo.roundCoordinates()
+	if geo.Latitude != 33.0198 || geo.Longitude != -96.69884 {
+		t.Errorf("default want full precision\ngot: %v,%v\n", geo.Latitude, geo.Longitude)
+	}
+
+	SetCoordinatePrecision(2)
+	defer SetCoordinatePrecision(-1)
+	geo.roundCoordinates()
+	if geo.Latitude != 33.02 || geo.Longitude != -96.70 {
+		t.Errorf("want: 33.02,-96.7\ngot: %v,%v\n", geo.Latitude, geo.Longitude)
+	}
+
+	SetCoordinatePrecision(0)
+	geo = GeoIPData{Latitude: 51.5074, Longitude: -0.1278}
+	geo.roundCoordinates()
+	if geo.Latitude != 52 || geo.Longitude != 0 {
+		t.Errorf("want: 52,0\ngot: %v,%v\n", geo.Latitude, geo.Longitude)
+	}
+}
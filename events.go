@@ -0,0 +1,52 @@
+package me_geolocate
+
+import "sync/atomic"
+
+var eventCh chan<- GeoIPData // see SetEventChannel
+var eventDropIfFull bool
+var eventDrops atomic.Uint64
+
+// SetEventChannel has every lookup result sent to ch as well as logged, so
+// the caller's own goroutine can batch and ship them somewhere.  Locators
+// from NewGeoLocator send theirs to WithEventChannel's instead.
+//
+// Backpressure: with dropIfFull, a result that doesn't fit in ch's buffer
+// is dropped and counted (see DroppedEvents), so a slow consumer never
+// slows lookups down.  Without it the send blocks, and GetGeoData waits
+// for the consumer.  A nil ch turns events off.
+func SetEventChannel(ch chan<- GeoIPData, dropIfFull bool) {
+	eventCh = ch
+	eventDropIfFull = dropIfFull
+}
+
+// DroppedEvents is how many results were dropped because the event
+// channel was full.
+func DroppedEvents() uint64 {
+	return eventDrops.Load()
+}
+
+// WithEventChannel has every result of the locator's lookups sent to ch
+// as well as logged, with SetEventChannel's backpressure rules.  Drops are
+// counted in Stats.EventsDropped.
+func WithEventChannel(ch chan<- GeoIPData, dropIfFull bool) Option {
+	return func(l *GeoLocator) {
+		l.eventCh = ch
+		l.eventDropIfFull = dropIfFull
+	}
+}
+
+// publishEvent sends geo to the locator's event channel if it has one.
+func (l *GeoLocator) publishEvent(geo GeoIPData) {
+	if l.eventCh == nil {
+		return
+	}
+	if !l.eventDropIfFull {
+		l.eventCh <- geo
+		return
+	}
+	select {
+	case l.eventCh <- geo:
+	default:
+		l.eventDrops.Add(1)
+	}
+}
@@ -0,0 +1,55 @@
+package me_geolocate
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetEventChannel(t *testing.T) {
+	useMiniredis(t)
+	useProvider(t, `{"isp":"Google LLC","country_code":"US","success":true}`)
+
+	ch := make(chan GeoIPData, 2)
+	SetEventChannel(ch, true)
+	defer SetEventChannel(nil, false)
+	drops := DroppedEvents()
+
+	GetGeoData("8.8.8.8")
+	GetGeoData("10.0.0.1")
+	GetGeoData("8.8.4.4") // buffer full, dropped
+
+	if got := DroppedEvents() - drops; got != 1 {
+		t.Errorf("drops want: 1\ngot: %d\n", got)
+	}
+	if geo := <-ch; geo.IP != "8.8.8.8" || geo.ISP != "Google LLC" {
+		t.Errorf("want: 8.8.8.8 Google LLC\ngot: %s %s\n", geo.IP, geo.ISP)
+	}
+	if geo := <-ch; geo.IP != "10.0.0.1" {
+		t.Errorf("want: 10.0.0.1\ngot: %s\n", geo.IP)
+	}
+}
+
+func TestWithEventChannel(t *testing.T) {
+	useProvider(t, `{"isp":"Google LLC","country_code":"US","success":true}`)
+	global := make(chan GeoIPData, 10)
+	SetEventChannel(global, true)
+	defer SetEventChannel(nil, false)
+
+	ch := make(chan GeoIPData, 1)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithEventChannel(ch, true))
+	defer l.Close()
+
+	l.GetGeoData(context.Background(), "8.8.8.8")
+	l.GetGeoData(context.Background(), "8.8.4.4") // buffer full, dropped
+
+	if geo := <-ch; geo.IP != "8.8.8.8" {
+		t.Errorf("want: 8.8.8.8\ngot: %s\n", geo.IP)
+	}
+	if got := l.Stats().EventsDropped; got != 1 {
+		t.Errorf("drops want: 1\ngot: %d\n", got)
+	}
+	// SetEventChannel is for the package-level functions only
+	if len(global) != 0 {
+		t.Errorf("want nothing on the package channel\ngot: %d\n", len(global))
+	}
+}
@@ -0,0 +1,71 @@
+package me_geolocate
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// GeoForwardedChain geolocates every hop of a request, see
+// GeoLocator.GeoForwardedChain.
+func GeoForwardedChain(ctx context.Context, r *http.Request) ([]GeoIPData, error) {
+	return std().GeoForwardedChain(ctx, r)
+}
+
+// GeoForwardedChain geolocates every hop of a request: each X-Forwarded-For
+// entry in order, then the connecting RemoteAddr.  Hops are never dropped -
+// private ones come back classified non-routable as usual, and entries that
+// aren't IPs come back with Provider "invalid" - so odd proxy chains show up.
+// The valid hops are looked up together with GetGeoDataBatch, whose error
+// is returned.
+func (l *GeoLocator) GeoForwardedChain(ctx context.Context, r *http.Request) ([]GeoIPData, error) {
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(h, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	if r.RemoteAddr != "" {
+		hops = append(hops, r.RemoteAddr)
+	}
+
+	chain := make([]GeoIPData, len(hops))
+	var valid []string
+	var at []int // chain index of each valid hop
+	for i, hop := range hops {
+		ip, ok := hopIP(hop)
+		if !ok {
+			chain[i] = newGeoIPData(hop)
+			chain[i].Provider = "invalid"
+			chain[i].Error = "Invalid IP address"
+			continue
+		}
+		valid = append(valid, ip)
+		at = append(at, i)
+	}
+	if len(valid) == 0 {
+		return chain, nil
+	}
+	results, err := l.GetGeoDataBatch(ctx, valid)
+	for j, geo := range results {
+		chain[at[j]] = geo
+	}
+	return chain, err
+}
+
+// hopIP pulls the address out of a forwarding hop, which may carry a port
+// ("1.2.3.4:5678", "[2001:db8::1]:443").
+func hopIP(hop string) (string, bool) {
+	if host, _, err := net.SplitHostPort(hop); err == nil {
+		hop = host
+	}
+	addr, err := netip.ParseAddr(strings.Trim(hop, "[]"))
+	if err != nil {
+		return "", false
+	}
+	return addr.String(), true
+}
@@ -0,0 +1,61 @@
+package me_geolocate
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGeoForwardedChain(t *testing.T) {
+	useMiniredis(t)
+	useProvider(t, `{"isp":"Some ISP","country_code":"US","success":true}`)
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Add("X-Forwarded-For", "8.8.8.8, 10.0.0.7:51234")
+	r.Header.Add("X-Forwarded-For", "garbage, [2001:4860:4860::8888]:443")
+	r.RemoteAddr = "1.1.1.1:8080"
+
+	chain, err := GeoForwardedChain(context.Background(), r)
+	if err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+	want := []struct{ ip, provider string }{
+		{"8.8.8.8", providerName},
+		{"10.0.0.7", "non-routable"},
+		{"garbage", "invalid"},
+		{"2001:4860:4860::8888", providerName},
+		{"1.1.1.1", providerName},
+	}
+	if len(chain) != len(want) {
+		t.Fatalf("want: %d hops\ngot: %d\n", len(want), len(chain))
+	}
+	for i, w := range want {
+		if chain[i].IP != w.ip || chain[i].Provider != w.provider {
+			t.Errorf("hop %d want: %s %s\ngot: %s %s\n", i, w.ip, w.provider, chain[i].IP, chain[i].Provider)
+		}
+	}
+}
+
+func TestGeoForwardedChainBatch(t *testing.T) {
+	useProvider(t, `{"isp":"Some ISP","country_code":"US","success":true}`)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(lookupURL))
+	defer l.Close()
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Add("X-Forwarded-For", "8.8.8.8, 8.8.8.8, nope")
+	r.RemoteAddr = "1.1.1.1:8080"
+	chain, err := l.GeoForwardedChain(context.Background(), r)
+	if err != nil || len(chain) != 4 || chain[2].Provider != "invalid" || chain[3].IP != "1.1.1.1" {
+		t.Fatalf("want: 4 hops, the third invalid\ngot: %+v %v\n", chain, err)
+	}
+	// one batch, so the repeated hop is looked up once
+	if st := l.Stats(); st.Misses != 2 {
+		t.Errorf("want: 2 misses\ngot: %d\n", st.Misses)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := l.GeoForwardedChain(ctx, r); err == nil {
+		t.Errorf("cancelled want: an error\ngot: nil\n")
+	}
+}
@@ -0,0 +1,7 @@
+// Package geopb is the protobuf form of me_geolocate.GeoIPData and the
+// GeoLocate gRPC service.  The .pb.go files are generated from the .proto
+// files - edit those and regenerate, never the Go.
+package geopb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative geoip.proto
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative geolocate.proto
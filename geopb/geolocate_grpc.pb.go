@@ -0,0 +1,202 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v5.27.1
+// source: geolocate.proto
+
+package geopb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	GeoLocate_Lookup_FullMethodName       = "/geolocate.v1.GeoLocate/Lookup"
+	GeoLocate_BatchLookup_FullMethodName  = "/geolocate.v1.GeoLocate/BatchLookup"
+	GeoLocate_StreamLookup_FullMethodName = "/geolocate.v1.GeoLocate/StreamLookup"
+)
+
+// GeoLocateClient is the client API for GeoLocate service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// GeoLocate looks IPs up, see me_geolocate.NewGRPCServer.
+type GeoLocateClient interface {
+	// Lookup answers one IP.
+	Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*GeoIPData, error)
+	// BatchLookup answers several IPs; results[i] is for ips[i].
+	BatchLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (*BatchLookupResponse, error)
+	// StreamLookup answers each request as it arrives, in order.
+	StreamLookup(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[LookupRequest, GeoIPData], error)
+}
+
+type geoLocateClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGeoLocateClient(cc grpc.ClientConnInterface) GeoLocateClient {
+	return &geoLocateClient{cc}
+}
+
+func (c *geoLocateClient) Lookup(ctx context.Context, in *LookupRequest, opts ...grpc.CallOption) (*GeoIPData, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GeoIPData)
+	err := c.cc.Invoke(ctx, GeoLocate_Lookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *geoLocateClient) BatchLookup(ctx context.Context, in *BatchLookupRequest, opts ...grpc.CallOption) (*BatchLookupResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(BatchLookupResponse)
+	err := c.cc.Invoke(ctx, GeoLocate_BatchLookup_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *geoLocateClient) StreamLookup(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[LookupRequest, GeoIPData], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &GeoLocate_ServiceDesc.Streams[0], GeoLocate_StreamLookup_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[LookupRequest, GeoIPData]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GeoLocate_StreamLookupClient = grpc.BidiStreamingClient[LookupRequest, GeoIPData]
+
+// GeoLocateServer is the server API for GeoLocate service.
+// All implementations must embed UnimplementedGeoLocateServer
+// for forward compatibility.
+//
+// GeoLocate looks IPs up, see me_geolocate.NewGRPCServer.
+type GeoLocateServer interface {
+	// Lookup answers one IP.
+	Lookup(context.Context, *LookupRequest) (*GeoIPData, error)
+	// BatchLookup answers several IPs; results[i] is for ips[i].
+	BatchLookup(context.Context, *BatchLookupRequest) (*BatchLookupResponse, error)
+	// StreamLookup answers each request as it arrives, in order.
+	StreamLookup(grpc.BidiStreamingServer[LookupRequest, GeoIPData]) error
+	mustEmbedUnimplementedGeoLocateServer()
+}
+
+// UnimplementedGeoLocateServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedGeoLocateServer struct{}
+
+func (UnimplementedGeoLocateServer) Lookup(context.Context, *LookupRequest) (*GeoIPData, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Lookup not implemented")
+}
+func (UnimplementedGeoLocateServer) BatchLookup(context.Context, *BatchLookupRequest) (*BatchLookupResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchLookup not implemented")
+}
+func (UnimplementedGeoLocateServer) StreamLookup(grpc.BidiStreamingServer[LookupRequest, GeoIPData]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamLookup not implemented")
+}
+func (UnimplementedGeoLocateServer) mustEmbedUnimplementedGeoLocateServer() {}
+func (UnimplementedGeoLocateServer) testEmbeddedByValue()                   {}
+
+// UnsafeGeoLocateServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GeoLocateServer will
+// result in compilation errors.
+type UnsafeGeoLocateServer interface {
+	mustEmbedUnimplementedGeoLocateServer()
+}
+
+func RegisterGeoLocateServer(s grpc.ServiceRegistrar, srv GeoLocateServer) {
+	// If the following call pancis, it indicates UnimplementedGeoLocateServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&GeoLocate_ServiceDesc, srv)
+}
+
+func _GeoLocate_Lookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(LookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeoLocateServer).Lookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GeoLocate_Lookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeoLocateServer).Lookup(ctx, req.(*LookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GeoLocate_BatchLookup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchLookupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GeoLocateServer).BatchLookup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: GeoLocate_BatchLookup_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GeoLocateServer).BatchLookup(ctx, req.(*BatchLookupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _GeoLocate_StreamLookup_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(GeoLocateServer).StreamLookup(&grpc.GenericServerStream[LookupRequest, GeoIPData]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type GeoLocate_StreamLookupServer = grpc.BidiStreamingServer[LookupRequest, GeoIPData]
+
+// GeoLocate_ServiceDesc is the grpc.ServiceDesc for GeoLocate service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var GeoLocate_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "geolocate.v1.GeoLocate",
+	HandlerType: (*GeoLocateServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Lookup",
+			Handler:    _GeoLocate_Lookup_Handler,
+		},
+		{
+			MethodName: "BatchLookup",
+			Handler:    _GeoLocate_BatchLookup_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamLookup",
+			Handler:       _GeoLocate_StreamLookup_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "geolocate.proto",
+}
@@ -0,0 +1,179 @@
+// Package geotest has test doubles for code that uses me_geolocate, so its
+// tests need neither Redis nor a live provider:
+//
+//   - Locator, an in-memory fake me_geolocate.Locator
+//   - Fixture and friends, to build GeoIPData
+//   - Server, a canned geoiplookup.io for a real GeoLocator to call
+package geotest
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"strings"
+	"sync"
+
+	"github.com/pootwaddle/me_geolocate"
+)
+
+// FixtureOption adjusts a Fixture.
+type FixtureOption func(*me_geolocate.GeoIPData)
+
+// Fixture is a located, routable answer for ip as a provider would give
+// it: Google's Mountain View record unless opts say otherwise.
+func Fixture(ip string, opts ...FixtureOption) me_geolocate.GeoIPData {
+	geo := me_geolocate.GeoIPData{
+		IP:            ip,
+		ISP:           "Google LLC",
+		Org:           "Google LLC",
+		Latitude:      37.4056,
+		Longitude:     -122.0775,
+		PostalCode:    "94043",
+		City:          "Mountain View",
+		CountryCode:   "US",
+		CountryName:   "United States",
+		ContinentCode: "NA",
+		ContinentName: "North America",
+		Region:        "California",
+		TimezoneName:  "America/Los_Angeles",
+		AsnNumber:     15169,
+		Asn:           "AS15169",
+		AsnOrg:        "Google LLC",
+		Success:       true,
+		Located:       true,
+		Routable:      true,
+		Provider:      "geoiplookup.io",
+	}
+	for _, opt := range opts {
+		opt(&geo)
+	}
+	return geo
+}
+
+// Unknown is the placeholder GetGeoData returns for ip when nothing
+// located it.
+func Unknown(ip string) me_geolocate.GeoIPData {
+	return me_geolocate.GeoIPData{
+		IP:          ip,
+		ISP:         "-----",
+		City:        "-----",
+		CountryCode: "--",
+		CountryName: "-----",
+		Routable:    true,
+	}
+}
+
+// WithCountry sets the country code and name.
+func WithCountry(code, name string) FixtureOption {
+	return func(g *me_geolocate.GeoIPData) { g.CountryCode, g.CountryName = code, name }
+}
+
+// WithCity sets the city and region.
+func WithCity(city, region string) FixtureOption {
+	return func(g *me_geolocate.GeoIPData) { g.City, g.Region = city, region }
+}
+
+// WithISP sets the ISP and organization.
+func WithISP(isp string) FixtureOption {
+	return func(g *me_geolocate.GeoIPData) { g.ISP, g.Org = isp, isp }
+}
+
+// WithASN sets the autonomous system.
+func WithASN(number int, org string) FixtureOption {
+	return func(g *me_geolocate.GeoIPData) {
+		g.AsnNumber, g.Asn, g.AsnOrg = number, fmt.Sprintf("AS%d", number), org
+	}
+}
+
+// WithLocation sets the coordinates.
+func WithLocation(lat, lon float64) FixtureOption {
+	return func(g *me_geolocate.GeoIPData) { g.Latitude, g.Longitude = lat, lon }
+}
+
+// Locator is an in-memory fake me_geolocate.Locator.  IPs
+// added with Set answer with their data, IPs added with SetError fail, and
+// anything else fails with ErrUpstreamUnavailable.  A string that isn't an
+// IP fails with ErrInvalidIP first, as from a GeoLocator.  It records the IPs it
+// was asked about.  The zero value is ready to use and it is safe for
+// concurrent use.
+type Locator struct {
+	mu    sync.Mutex
+	data  map[string]me_geolocate.GeoIPData
+	errs  map[string]error
+	calls []string
+}
+
+var _ me_geolocate.Locator = (*Locator)(nil)
+
+// NewLocator returns a Locator answering with geos, keyed by their IP.
+func NewLocator(geos ...me_geolocate.GeoIPData) *Locator {
+	l := &Locator{}
+	for _, geo := range geos {
+		l.Set(geo.IP, geo)
+	}
+	return l
+}
+
+// Set makes lookups of ip answer geo.
+func (l *Locator) Set(ip string, geo me_geolocate.GeoIPData) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.data == nil {
+		l.data = make(map[string]me_geolocate.GeoIPData)
+	}
+	l.data[ip] = geo
+	delete(l.errs, ip)
+}
+
+// SetError makes lookups of ip fail with err, returning the placeholder.
+func (l *Locator) SetError(ip string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.errs == nil {
+		l.errs = make(map[string]error)
+	}
+	l.errs[ip] = err
+	delete(l.data, ip)
+}
+
+// Calls returns the IPs looked up so far, in order.
+func (l *Locator) Calls() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.calls...)
+}
+
+func (l *Locator) GetGeoData(ctx context.Context, ip string) (me_geolocate.GeoIPData, error) {
+	if err := ctx.Err(); err != nil {
+		return Unknown(ip), err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.calls = append(l.calls, ip)
+	if _, err := netip.ParseAddr(strings.TrimSpace(ip)); err != nil {
+		geo := Unknown(ip)
+		geo.Routable = false
+		geo.Provider = "invalid"
+		geo.Error = "Invalid IP address"
+		return geo, fmt.Errorf("%w: %q", me_geolocate.ErrInvalidIP, ip)
+	}
+	if geo, ok := l.data[ip]; ok {
+		return geo, nil
+	}
+	if err, ok := l.errs[ip]; ok {
+		return Unknown(ip), err
+	}
+	return Unknown(ip), fmt.Errorf("%w: geotest has no answer for %s", me_geolocate.ErrUpstreamUnavailable, ip)
+}
+
+func (l *Locator) GetGeoDataBatch(ctx context.Context, ips []string) ([]me_geolocate.GeoIPData, error) {
+	results := make([]me_geolocate.GeoIPData, len(ips))
+	for i, ip := range ips {
+		geo, err := l.GetGeoData(ctx, ip)
+		results[i] = geo
+		if err != nil && ctx.Err() == nil && results[i].Error == "" {
+			results[i].Error = strings.TrimSpace(err.Error())
+		}
+	}
+	return results, ctx.Err()
+}
@@ -0,0 +1,89 @@
+package geotest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/pootwaddle/me_geolocate"
+)
+
+func TestFixture(t *testing.T) {
+	geo := Fixture("1.1.1.1", WithISP("Cloudflare, Inc."), WithCountry("AU", "Australia"), WithCity("Sydney", "New South Wales"), WithASN(13335, "Cloudflare, Inc."))
+	if geo.IP != "1.1.1.1" || geo.ISP != "Cloudflare, Inc." || geo.CountryCode != "AU" || geo.City != "Sydney" || geo.Asn != "AS13335" || !geo.Located {
+		t.Errorf("want: located Cloudflare Sydney AU AS13335\ngot: %+v\n", geo)
+	}
+}
+
+func TestLocator(t *testing.T) {
+	ctx := context.Background()
+	l := NewLocator(Fixture("8.8.8.8"))
+	l.SetError("10.0.0.1", me_geolocate.ErrNonRoutable)
+
+	if geo, err := l.GetGeoData(ctx, "8.8.8.8"); err != nil || geo.CountryCode != "US" {
+		t.Errorf("want: US\ngot: %s %v\n", geo.CountryCode, err)
+	}
+	if geo, err := l.GetGeoData(ctx, "10.0.0.1"); !errors.Is(err, me_geolocate.ErrNonRoutable) || geo.CountryCode != "--" {
+		t.Errorf("want: placeholder, ErrNonRoutable\ngot: %s %v\n", geo.CountryCode, err)
+	}
+	if _, err := l.GetGeoData(ctx, "1.1.1.1"); !errors.Is(err, me_geolocate.ErrUpstreamUnavailable) {
+		t.Errorf("want: ErrUpstreamUnavailable\ngot: %v\n", err)
+	}
+
+	if geo, err := l.GetGeoData(ctx, "nope"); !errors.Is(err, me_geolocate.ErrInvalidIP) || geo.Provider != "invalid" {
+		t.Errorf("want: invalid, ErrInvalidIP\ngot: %s %v\n", geo.Provider, err)
+	}
+
+	results, err := l.GetGeoDataBatch(ctx, []string{"8.8.8.8", "1.1.1.1", "nope"})
+	if err != nil || len(results) != 3 || results[0].ISP != "Google LLC" || results[1].Error == "" || results[2].Error != "Invalid IP address" {
+		t.Errorf("want: Google LLC, an error, then invalid\ngot: %+v %v\n", results, err)
+	}
+	want := []string{"8.8.8.8", "10.0.0.1", "1.1.1.1", "nope", "8.8.8.8", "1.1.1.1", "nope"}
+	if got := l.Calls(); !reflect.DeepEqual(want, got) {
+		t.Errorf("want: %v\ngot: %v\n", want, got)
+	}
+}
+
+func TestServer(t *testing.T) {
+	srv := NewServer(Fixture("8.8.8.8"))
+	defer srv.Close()
+
+	l := me_geolocate.NewGeoLocator(nil, me_geolocate.WithCache(me_geolocate.NewMemoryCache(10)), me_geolocate.WithLookupURL(srv.LookupURL()))
+	defer l.Close()
+	ctx := context.Background()
+
+	geo, err := l.GetGeoData(ctx, "8.8.8.8")
+	if err != nil || geo.ISP != "Google LLC" || geo.City != "Mountain View" {
+		t.Errorf("want: Google LLC Mountain View\ngot: %s %s %v\n", geo.ISP, geo.City, err)
+	}
+	l.GetGeoData(ctx, "8.8.8.8")
+	if srv.Hits("8.8.8.8") != 1 {
+		t.Errorf("want: 1 hit, then cached\ngot: %d\n", srv.Hits("8.8.8.8"))
+	}
+
+	if _, err := l.GetGeoData(ctx, "1.1.1.1"); !errors.Is(err, me_geolocate.ErrUpstreamUnavailable) {
+		t.Errorf("want: ErrUpstreamUnavailable\ngot: %v\n", err)
+	}
+}
+
+func TestLocatorInjected(t *testing.T) {
+	srv := httptest.NewServer(me_geolocate.NewServer(NewLocator(Fixture("8.8.8.8"))))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/v1/geoip/8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var geo me_geolocate.GeoIPData
+	if err := json.NewDecoder(resp.Body).Decode(&geo); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || geo.City != "Mountain View" {
+		t.Errorf("want: 200 Mountain View\ngot: %d %s\n", resp.StatusCode, geo.City)
+	}
+}
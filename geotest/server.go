@@ -0,0 +1,69 @@
+package geotest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+
+	"github.com/pootwaddle/me_geolocate"
+)
+
+// Server is a canned geoiplookup.io.  Point a GeoLocator at it with
+// me_geolocate.WithLookupURL(s.LookupURL()).  IPs it has no answer for get
+// geoiplookup.io's failure response.
+type Server struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	answers map[string]me_geolocate.GeoIPData
+	hits    map[string]int
+}
+
+// NewServer starts a Server answering with geos, keyed by their IP.
+// Close it when done.
+func NewServer(geos ...me_geolocate.GeoIPData) *Server {
+	s := &Server{answers: make(map[string]me_geolocate.GeoIPData), hits: make(map[string]int)}
+	for _, geo := range geos {
+		s.answers[geo.IP] = geo
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// LookupURL is the format for me_geolocate.WithLookupURL.
+func (s *Server) LookupURL() string {
+	return s.URL + "/%s"
+}
+
+// Set makes the server answer geo for ip.
+func (s *Server) Set(ip string, geo me_geolocate.GeoIPData) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.answers[ip] = geo
+}
+
+// Hits is how many times ip was asked about.
+func (s *Server) Hits(ip string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[ip]
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	ip := strings.TrimPrefix(r.URL.Path, "/")
+	s.mu.Lock()
+	s.hits[ip]++
+	geo, ok := s.answers[ip]
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		fmt.Fprintf(w, `{"ip":%q,"success":false,"error":"Invalid public IPv4 or IPv6 address"}`, ip)
+		return
+	}
+	geo.Success = true
+	json.NewEncoder(w).Encode(geo)
+}
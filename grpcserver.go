@@ -0,0 +1,79 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/pootwaddle/me_geolocate/geopb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// grpcServer is the GeoLocate gRPC service, see NewGRPCServer.
+type grpcServer struct {
+	geopb.UnimplementedGeoLocateServer
+	locator Locator
+}
+
+// NewGRPCServer serves lookups from l over gRPC; register it with
+// geopb.RegisterGeoLocateServer.  An IP that isn't one is InvalidArgument.
+// A batch that can't be answered is Unavailable, or ResourceExhausted if
+// the provider is rate limiting us.  Closing l is up to the caller.
+func NewGRPCServer(l Locator) geopb.GeoLocateServer {
+	return &grpcServer{locator: l}
+}
+
+func (s *grpcServer) Lookup(ctx context.Context, req *geopb.LookupRequest) (*geopb.GeoIPData, error) {
+	geo, err := s.locator.GetGeoData(ctx, req.GetIp())
+	if errors.Is(err, ErrInvalidIP) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid IP address %q", req.GetIp())
+	}
+	return geo.ToProto(), nil
+}
+
+func (s *grpcServer) BatchLookup(ctx context.Context, req *geopb.BatchLookupRequest) (*geopb.BatchLookupResponse, error) {
+	if len(req.GetIps()) > maxServerBatch {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d IPs per batch", maxServerBatch)
+	}
+	results, err := s.locator.GetGeoDataBatch(ctx, req.GetIps())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &geopb.BatchLookupResponse{Results: make([]*geopb.GeoIPData, len(results))}
+	for i, geo := range results {
+		resp.Results[i] = geo.ToProto()
+	}
+	return resp, nil
+}
+
+// grpcError is the status for a batch that failed with err.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	case errors.Is(err, ErrRateLimited):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	default: // ErrNoCache, or ErrUpstreamUnavailable with WithFailFastBatch
+		return status.Error(codes.Unavailable, err.Error())
+	}
+}
+
+func (s *grpcServer) StreamLookup(stream geopb.GeoLocate_StreamLookupServer) error {
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		geo, err := s.Lookup(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(geo); err != nil {
+			return err
+		}
+	}
+}
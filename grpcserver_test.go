@@ -0,0 +1,119 @@
+package me_geolocate
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/pootwaddle/me_geolocate/geopb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func testGRPCClient(t *testing.T) geopb.GeoLocateClient {
+	t.Helper()
+	url := providerServer(t, `{"ip":"8.8.8.8","country":"US","org":"AS15169 Google LLC"}`, nil)
+	return testGRPCClientFor(t, NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithProvider(&IPInfoProvider{URL: url + "/%s/json"})))
+}
+
+// testGRPCClientFor serves l over gRPC for the length of the test.
+func testGRPCClientFor(t *testing.T, l *GeoLocator) geopb.GeoLocateClient {
+	t.Helper()
+	t.Cleanup(func() { l.Close() })
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	geopb.RegisterGeoLocateServer(srv, NewGRPCServer(l))
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return geopb.NewGeoLocateClient(conn)
+}
+
+func TestGRPCLookup(t *testing.T) {
+	c := testGRPCClient(t)
+
+	geo, err := c.Lookup(context.Background(), &geopb.LookupRequest{Ip: "8.8.8.8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if geo.GetCountryCode() != "US" || geo.GetIp() != "8.8.8.8" {
+		t.Errorf("want: 8.8.8.8 US\ngot: %s %s\n", geo.GetIp(), geo.GetCountryCode())
+	}
+
+	_, err = c.Lookup(context.Background(), &geopb.LookupRequest{Ip: "nope"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("want: InvalidArgument\ngot: %v\n", err)
+	}
+}
+
+func TestGRPCBatchLookup(t *testing.T) {
+	c := testGRPCClient(t)
+
+	resp, err := c.BatchLookup(context.Background(), &geopb.BatchLookupRequest{Ips: []string{"8.8.8.8", "10.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.GetResults()) != 2 || resp.GetResults()[0].GetCountryCode() != "US" || resp.GetResults()[1].GetIp() != "10.0.0.1" {
+		t.Errorf("want: US, 10.0.0.1\ngot: %v\n", resp.GetResults())
+	}
+}
+
+func TestGRPCBatchLookupErrors(t *testing.T) {
+	req := &geopb.BatchLookupRequest{Ips: []string{"8.8.8.8"}}
+
+	c := testGRPCClientFor(t, NewGeoLocator(nil, WithRedisAddr("")))
+	if _, err := c.BatchLookup(context.Background(), req); status.Code(err) != codes.Unavailable {
+		t.Errorf("no cache want: Unavailable\ngot: %v\n", err)
+	}
+
+	c = testGRPCClientFor(t, NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL("http://127.0.0.1:1/%s"), WithFailFastBatch(true)))
+	if _, err := c.BatchLookup(context.Background(), req); status.Code(err) != codes.Unavailable {
+		t.Errorf("provider down want: Unavailable\ngot: %v\n", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := grpcError(fmt.Errorf("%w: %w", ErrUpstreamUnavailable, ctx.Err())); status.Code(err) != codes.Canceled {
+		t.Errorf("cancelled want: Canceled\ngot: %v\n", err)
+	}
+	if err := grpcError(context.DeadlineExceeded); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("deadline want: DeadlineExceeded\ngot: %v\n", err)
+	}
+	if err := grpcError(ErrRateLimited); status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("rate limited want: ResourceExhausted\ngot: %v\n", err)
+	}
+}
+
+func TestGRPCStreamLookup(t *testing.T) {
+	c := testGRPCClient(t)
+
+	stream, err := c.StreamLookup(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ip := range []string{"8.8.8.8", "10.0.0.1"} {
+		if err := stream.Send(&geopb.LookupRequest{Ip: ip}); err != nil {
+			t.Fatal(err)
+		}
+		geo, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if geo.GetIp() != ip {
+			t.Errorf("want: %s\ngot: %s\n", ip, geo.GetIp())
+		}
+	}
+	stream.CloseSend()
+}
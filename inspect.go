@@ -0,0 +1,51 @@
+package me_geolocate
+
+import (
+	"context"
+	"time"
+)
+
+// Source says where a lookup was answered from.
+type Source string
+
+const (
+	SourceCache       Source = "cache"
+	SourceProvider    Source = "provider"
+	SourceLocal       Source = "local"
+	SourceNonRoutable Source = "non-routable"
+	SourceReserved    Source = "reserved"
+	SourceOverride    Source = "override"
+)
+
+// Inspect looks up ip and also reports where the answer came from and how
+// long the cached entry has left to live.  The TTL is zero when the answer
+// didn't come from the cache.  Meant for admin/debug pages.
+func Inspect(ctx context.Context, ip string) (GeoIPData, Source, time.Duration, error) {
+	return std().Inspect(ctx, ip)
+}
+
+// Inspect is the package-level Inspect for this locator.  The error is
+// GetGeoData's, or the TTL read's.
+func (l *GeoLocator) Inspect(ctx context.Context, ip string) (GeoIPData, Source, time.Duration, error) {
+	geo, err := l.GetGeoData(ctx, ip)
+
+	switch {
+	case geo.CacheHit:
+	case geo.Provider == "local":
+		return geo, SourceLocal, 0, err
+	case geo.Provider == "non-routable":
+		return geo, SourceNonRoutable, 0, err
+	case geo.Provider == "reserved":
+		return geo, SourceReserved, 0, err
+	case geo.Provider == "override":
+		return geo, SourceOverride, 0, err
+	default:
+		return geo, SourceProvider, 0, err
+	}
+
+	ttl, terr := remainingTTL(ctx, l.cache, cacheKey(geo.IP))
+	if err == nil {
+		err = terr
+	}
+	return geo, SourceCache, ttl, err
+}
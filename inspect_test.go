@@ -0,0 +1,42 @@
+package me_geolocate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	mr := useMiniredis(t)
+	useProvider(t, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	ctx := context.Background()
+
+	geo, src, ttl, err := Inspect(ctx, "8.8.8.8")
+	if err != nil || src != SourceProvider || ttl != 0 || geo.ISP != "Google LLC" {
+		t.Errorf("first want: provider, no TTL\ngot: %s %s %v\n", src, ttl, err)
+	}
+	mr.SetTTL("geo:8.8.8.8", time.Hour)
+	geo, src, ttl, err = Inspect(ctx, "8.8.8.8")
+	if err != nil || src != SourceCache || ttl != time.Hour || !geo.CacheHit {
+		t.Errorf("second want: cache, 1h\ngot: %s %s %v\n", src, ttl, err)
+	}
+	if _, src, _, _ := Inspect(ctx, "10.0.0.1"); src != SourceNonRoutable {
+		t.Errorf("10.0.0.1 want: %s\ngot: %s\n", SourceNonRoutable, src)
+	}
+
+	// a locator's own cache, here in memory
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(lookupURL), WithTTL(time.Hour))
+	defer l.Close()
+	l.GetGeoData(ctx, "8.8.8.8")
+	_, src, ttl, err = l.Inspect(ctx, "8.8.8.8")
+	if err != nil || src != SourceCache || ttl <= 59*time.Minute || ttl > time.Hour {
+		t.Errorf("locator want: cache, about 1h\ngot: %s %s %v\n", src, ttl, err)
+	}
+
+	// ctx bounds the lookup
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, _, _, err := l.Inspect(cancelled, "1.1.1.1"); err == nil {
+		t.Errorf("cancelled want: an error\ngot: nil\n")
+	}
+}
@@ -0,0 +1,123 @@
+package me_geolocate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// IPAPIProvider is ip-api.com.  The free endpoint is plain HTTP and
+// limited to 45 lookups a minute; point URL at pro.ip-api.com with your
+// key for more.  The zero value uses the package's pooled client.
+type IPAPIProvider struct {
+	Client     *http.Client
+	URL        string // format with one %s for the IP, default ipAPIURL
+	CountryURL string // the same for LookupCountry, default ipAPICountryURL
+}
+
+const ipAPIURL = "http://ip-api.com/json/%s?fields=status,message,continent,continentCode,country,countryCode,regionName,city,district,zip,lat,lon,timezone,currency,isp,org,as,asname,reverse,query"
+
+// ipAPICountryURL asks for just the country, see WithCountryOnly.
+const ipAPICountryURL = "http://ip-api.com/json/%s?fields=status,message,continent,continentCode,country,countryCode"
+
+type ipAPIAnswer struct {
+	Status        string  `json:"status"`
+	Message       string  `json:"message"`
+	Continent     string  `json:"continent"`
+	ContinentCode string  `json:"continentCode"`
+	Country       string  `json:"country"`
+	CountryCode   string  `json:"countryCode"`
+	RegionName    string  `json:"regionName"`
+	City          string  `json:"city"`
+	District      string  `json:"district"`
+	Zip           string  `json:"zip"`
+	Lat           float64 `json:"lat"`
+	Lon           float64 `json:"lon"`
+	Timezone      string  `json:"timezone"`
+	Currency      string  `json:"currency"`
+	ISP           string  `json:"isp"`
+	Org           string  `json:"org"`
+	AS            string  `json:"as"`
+	ASName        string  `json:"asname"`
+	Reverse       string  `json:"reverse"`
+}
+
+func (p *IPAPIProvider) Name() string { return "ip-api.com" }
+
+func (p *IPAPIProvider) Lookup(ctx context.Context, g *GeoIPData) error {
+	url := p.URL
+	if url == "" {
+		url = ipAPIURL
+	}
+	return p.lookup(ctx, url, g)
+}
+
+// LookupCountry asks only for the country and continent, see
+// WithCountryOnly.
+func (p *IPAPIProvider) LookupCountry(ctx context.Context, g *GeoIPData) error {
+	url := p.CountryURL
+	if url == "" {
+		url = ipAPICountryURL
+	}
+	return p.lookup(ctx, url, g)
+}
+
+func (p *IPAPIProvider) lookup(ctx context.Context, url string, g *GeoIPData) error {
+	byt, err := providerGet(ctx, p.Client, fmt.Sprintf(url, g.IP), nil, g)
+	if err != nil {
+		return err
+	}
+
+	var answer ipAPIAnswer
+	if err := json.Unmarshal(byt, &answer); err != nil {
+		g.Error = fmt.Sprintf("GetGeoData could not parse response for IP: %s - %s", g.IP, err)
+		return errors.New(g.Error)
+	}
+	if answer.Status != "success" {
+		if answer.Message != "" {
+			g.Error = answer.Message
+		}
+		return fmt.Errorf("GetGeoData provider did not locate IP: %s - %s", g.IP, g.Error)
+	}
+	if g.Error != "" {
+		// non-200 with a success body
+		return errors.New(g.Error)
+	}
+
+	g.Success = true
+	g.ContinentName = answer.Continent
+	g.ContinentCode = answer.ContinentCode
+	g.CountryName = answer.Country
+	g.CountryCode = answer.CountryCode
+	g.Region = answer.RegionName
+	g.City = answer.City
+	g.District = answer.District
+	g.PostalCode = answer.Zip
+	g.Latitude = answer.Lat
+	g.Longitude = answer.Lon
+	g.TimezoneName = answer.Timezone
+	g.CurrencyCode = answer.Currency
+	g.ISP = answer.ISP
+	g.Org = answer.Org
+	g.Hostname = answer.Reverse
+	g.AsnNumber, g.Asn, g.AsnOrg = parseAS(answer.AS)
+	if answer.ASName != "" && g.AsnOrg == "" {
+		g.AsnOrg = answer.ASName
+	}
+	return nil
+}
+
+// parseAS splits an "AS15169 Google LLC" style AS description into its
+// number, "AS15169" and the organisation.
+func parseAS(s string) (int, string, string) {
+	asn, org, _ := strings.Cut(strings.TrimSpace(s), " ")
+	n, err := strconv.Atoi(strings.TrimPrefix(asn, "AS"))
+	if !strings.HasPrefix(asn, "AS") || err != nil {
+		return 0, "", strings.TrimSpace(s)
+	}
+	return n, asn, strings.TrimSpace(org)
+}
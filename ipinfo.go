@@ -0,0 +1,117 @@
+package me_geolocate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// IPInfoProvider is ipinfo.io.  Token is the API token, sent as a bearer
+// token; without one ipinfo.io allows a small number of lookups.  The
+// zero value uses the package's pooled client.
+type IPInfoProvider struct {
+	Client     *http.Client
+	Token      string
+	URL        string // format with one %s for the IP, default https://ipinfo.io/%s/json
+	CountryURL string // the same for LookupCountry, default https://ipinfo.io/%s/country
+}
+
+type ipInfoAnswer struct {
+	Hostname string `json:"hostname"`
+	City     string `json:"city"`
+	Region   string `json:"region"`
+	Country  string `json:"country"`
+	Loc      string `json:"loc"`
+	Org      string `json:"org"`
+	Postal   string `json:"postal"`
+	Timezone string `json:"timezone"`
+	Bogon    bool   `json:"bogon"`
+	Error    *struct {
+		Title   string `json:"title"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *IPInfoProvider) Name() string { return "ipinfo.io" }
+
+func (p *IPInfoProvider) Lookup(ctx context.Context, g *GeoIPData) error {
+	url := p.URL
+	if url == "" {
+		url = "https://ipinfo.io/%s/json"
+	}
+	byt, err := providerGet(ctx, p.Client, fmt.Sprintf(url, g.IP), p.header(), g)
+	if err != nil {
+		return err
+	}
+
+	var answer ipInfoAnswer
+	if err := json.Unmarshal(byt, &answer); err != nil {
+		g.Error = fmt.Sprintf("GetGeoData could not parse response for IP: %s - %s", g.IP, err)
+		return errors.New(g.Error)
+	}
+	switch {
+	case answer.Error != nil:
+		g.Error = strings.TrimSpace(answer.Error.Title + " - " + answer.Error.Message)
+	case answer.Bogon:
+		// same wording as geoiplookup.io, so callers see one message
+		g.Error = "Invalid public IPv4 or IPv6 address"
+	}
+	if g.Error != "" {
+		return fmt.Errorf("GetGeoData provider did not locate IP: %s - %s", g.IP, g.Error)
+	}
+
+	g.Success = true
+	g.Hostname = answer.Hostname
+	g.City = answer.City
+	g.Region = answer.Region
+	g.CountryCode = answer.Country
+	g.PostalCode = answer.Postal
+	g.TimezoneName = answer.Timezone
+	if lat, lon, ok := strings.Cut(answer.Loc, ","); ok {
+		g.Latitude, _ = strconv.ParseFloat(lat, 64)
+		g.Longitude, _ = strconv.ParseFloat(lon, 64)
+	}
+	g.AsnNumber, g.Asn, g.AsnOrg = parseAS(answer.Org)
+	g.ISP = g.AsnOrg
+	g.Org = g.AsnOrg
+	return nil
+}
+
+// LookupCountry asks only for the country, which ipinfo.io answers as
+// plain text, see WithCountryOnly.
+func (p *IPInfoProvider) LookupCountry(ctx context.Context, g *GeoIPData) error {
+	url := p.CountryURL
+	if url == "" {
+		url = "https://ipinfo.io/%s/country"
+	}
+	byt, err := providerGet(ctx, p.Client, fmt.Sprintf(url, g.IP), p.header(), g)
+	if err != nil {
+		return err
+	}
+	if g.Error != "" {
+		return fmt.Errorf("GetGeoData provider did not locate IP: %s - %s", g.IP, g.Error)
+	}
+	cc := strings.TrimSpace(string(byt))
+	if len(cc) != 2 {
+		// bogons and unknown addresses don't get a country code
+		g.Error = fmt.Sprintf("no country for IP: %s - %q", g.IP, cc)
+		return fmt.Errorf("GetGeoData provider did not locate IP: %s - %s", g.IP, g.Error)
+	}
+
+	g.Success = true
+	g.CountryCode = cc
+	return nil
+}
+
+// header carries the API token, if there is one.
+func (p *IPInfoProvider) header() http.Header {
+	header := http.Header{}
+	if p.Token != "" {
+		header.Set("Authorization", "Bearer "+p.Token)
+	}
+	return header
+}
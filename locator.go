@@ -0,0 +1,733 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/romana/rlog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/time/rate"
+)
+
+// Locator is what the package's consumers look IPs up through.  GeoLocator
+// implements it; depend on Locator instead to swap in another, e.g. the
+// fake in geotest.
+type Locator interface {
+	GetGeoData(ctx context.Context, ip string) (GeoIPData, error)
+	GetGeoDataBatch(ctx context.Context, ips []string) ([]GeoIPData, error)
+}
+
+var _ Locator = (*GeoLocator)(nil)
+
+// GeoLocator does lookups with its own cache connection, TTL and provider
+// settings, for programs that want to configure it in code or need more
+// than one.  The package-level GetGeoData uses a locator built from
+// REDIS_CONF and the Set* functions.
+type GeoLocator struct {
+	logger           *slog.Logger
+	cache            Cache       // nil = no cache
+	rcache           *RedisCache // the Redis under cache, nil if there isn't one
+	ownsCache        io.Closer   // built from redisAddr, so Close closes it
+	nearSize         int         // see WithLocalCache
+	cacheHealth      *cacheHealth
+	nearTTL          time.Duration
+	redisAddr        string
+	redisDB          int
+	redisConfig      *RedisConfig          // see WithRedisConfig
+	redisClient      redis.UniversalClient // see WithRedisClient
+	keyPrefix        string
+	ttl              time.Duration
+	httpClient       *http.Client
+	lookupURL        string
+	httpTimeout      *time.Duration    // nil = the client's own
+	providers        []Provider        // tried in order until one answers
+	breakers         []*circuitBreaker // one per provider, nil = no breaker
+	validate         bool              // see WithValidation
+	countryOnly      bool              // see WithCountryOnly
+	required         []string
+	asnDB            *MMDBProvider
+	localNets        []localNetwork
+	testIP           string // see WithTestIP
+	testIPData       GeoIPData
+	overrides        []overrideRule   // see WithOverridesFile, longest prefix first
+	eventCh          chan<- GeoIPData // see WithEventChannel
+	eventDropIfFull  bool
+	eventDrops       *atomic.Uint64
+	workers          int           // provider lookups in flight per batch
+	failFast         bool          // see WithFailFastBatch
+	synchronous      bool          // see WithSynchronous
+	warmup           bool          // see WithWarmup
+	lookupTimeout    time.Duration // 0 = the caller's ctx alone
+	latencyBudget    time.Duration // 0 = no budget, see WithLatencyBudget
+	staleKeep        time.Duration
+	stale            *staleCache // nil unless there is a budget
+	writeRetrySize   int         // 0 = failed cache writes aren't retried
+	writeRetryWindow time.Duration
+	writes           *writeQueue
+	pool             *workerPool // nil = a goroutine per background task
+	flight           *singleflight.Group
+
+	limiter       *rate.Limiter // nil = no limit
+	rejectLimited bool
+	retry         RetryPolicy
+	breakerPolicy BreakerPolicy
+	negativeTTL   time.Duration   // 0 = failed lookups aren't cached
+	staleAfter    time.Duration   // 0 = entries are never refreshed early
+	backoff       refreshBackoff  // see WithRefreshBackoff
+	baseCtx       context.Context // nil = context.Background()
+	refreshes     sync.WaitGroup
+	lifeMu        sync.Mutex // guards closed against refreshes.Add
+	closed        bool
+	closeOnce     sync.Once
+	closeErr      error
+	metrics       *metrics // nil = not collected
+	counters      counters // see Stats
+	expvar        bool     // see WithExpvar
+	tracer        trace.Tracer
+}
+
+// Option configures a GeoLocator, see NewGeoLocator.
+type Option func(*GeoLocator)
+
+// WithRedisAddr sets the cache address, in any form REDIS_CONF accepts.
+// It defaults to REDIS_CONF; an empty addr means no cache.  WithCache
+// takes precedence.
+func WithRedisAddr(addr string) Option {
+	return func(l *GeoLocator) { l.redisAddr = addr }
+}
+
+// WithRedisClient caches in Redis through c, sharing a client the
+// application already has rather than opening another pool.  It takes
+// precedence over WithRedisConfig and WithRedisAddr.  The locator doesn't
+// close it.
+func WithRedisClient(c redis.UniversalClient) Option {
+	return func(l *GeoLocator) { l.redisClient = c }
+}
+
+// WithRedisDB selects the Redis DB, overriding one given in a redis:// URL.
+func WithRedisDB(db int) Option {
+	return func(l *GeoLocator) { l.redisDB = db }
+}
+
+// WithKeyPrefix namespaces the locator's Redis keys, see
+// SetCacheKeyPrefix, whose setting is the default.
+func WithKeyPrefix(prefix string) Option {
+	return func(l *GeoLocator) { l.keyPrefix = prefix }
+}
+
+// WithCache uses c instead of Redis, e.g. NewMemoryCache for tools with
+// no Redis server.  The locator doesn't close it.
+func WithCache(c Cache) Option {
+	return func(l *GeoLocator) { l.cache = c }
+}
+
+// WithLocalCache fronts the cache with an in-process LRU of size entries
+// kept for up to ttl, see NewTieredCache.
+func WithLocalCache(size int, ttl time.Duration) Option {
+	return func(l *GeoLocator) { l.nearSize, l.nearTTL = size, ttl }
+}
+
+// WithTTL sets how long cache entries live.  The default follows SetTTL.
+func WithTTL(d time.Duration) Option {
+	return func(l *GeoLocator) { l.ttl = d }
+}
+
+// WithHTTPClient sets the client used for geoiplookup.io calls.  The
+// default, or nil, shares the package's pooled client.
+func WithHTTPClient(c *http.Client) Option {
+	return func(l *GeoLocator) { l.httpClient = c }
+}
+
+// WithHTTPTimeout bounds each provider call made with the locator's
+// client, overriding SetProviderTimeout.  It applies to a WithHTTPClient
+// client too, without changing the caller's copy.
+func WithHTTPTimeout(d time.Duration) Option {
+	return func(l *GeoLocator) { l.httpTimeout = &d }
+}
+
+// WithLookupURL points geoiplookup.io calls somewhere else, e.g. a proxy
+// or a test server.  url is a format with one %s for the IP.
+func WithLookupURL(url string) Option {
+	return func(l *GeoLocator) { l.lookupURL = url }
+}
+
+// WithProvider looks IPs up with p instead of geoiplookup.io, e.g.
+// &IPInfoProvider{Token: token}.  WithHTTPClient and WithLookupURL don't
+// apply to it.
+func WithProvider(p Provider) Option {
+	return func(l *GeoLocator) { l.providers = []Provider{p} }
+}
+
+// WithProviderChain tries each provider in turn, moving on to the next
+// when one fails (an error, a non-200, an answer that doesn't locate the
+// IP or one failing WithValidation).  GeoIPData.Provider records which one
+// answered.
+func WithProviderChain(providers ...Provider) Option {
+	return func(l *GeoLocator) { l.providers = providers }
+}
+
+// WithLocalNetworks answers lookups in these LAN ranges locally, see
+// SetLocalNetworks, whose setting is the default.  Rules with a bad CIDR
+// are logged and skipped.
+func WithLocalNetworks(rules []LocalNetRule) Option {
+	return func(l *GeoLocator) {
+		var nets []localNetwork
+		for _, r := range rules {
+			n, err := parseLocalNetworks([]LocalNetRule{r})
+			if err != nil {
+				l.errorf("WithLocalNetworks skipping rule - %s", err)
+				continue
+			}
+			nets = append(nets, n...)
+		}
+		l.localNets = nets
+	}
+}
+
+// WithTestIP makes the locator answer data for exactly ip, without
+// touching the cache or the provider, see SetTestIP, which only applies to
+// the package-level functions.  An empty ip turns it off.
+func WithTestIP(ip string, data GeoIPData) Option {
+	return func(l *GeoLocator) {
+		if data.IP == "" {
+			data.IP = ip
+		}
+		l.testIP = ip
+		l.testIPData = data
+	}
+}
+
+// WithOverridesFile answers lookups covered by the static corrections in
+// the file at path instead of asking the provider, see LoadOverrides for
+// the format, which only applies to the package-level functions.  The file
+// is read once, here.  A missing or malformed file is logged and the
+// locator has no overrides.
+func WithOverridesFile(path string) Option {
+	return func(l *GeoLocator) {
+		rules, err := readOverrides(path)
+		if err != nil {
+			l.errorf("WithOverridesFile - %s", err)
+			rules = nil
+		}
+		l.overrides = rules
+	}
+}
+
+// WithASNDatabase fills in AsnNumber, Asn and AsnOrg from db's ASN
+// database when the provider that answered didn't supply them, e.g.
+// NewMMDBProvider("", "GeoLite2-ASN.mmdb", time.Hour).  The locator
+// doesn't close db.
+func WithASNDatabase(db *MMDBProvider) Option {
+	return func(l *GeoLocator) { l.asnDB = db }
+}
+
+// WithNegativeTTL caches failed provider lookups for d, so an IP the
+// provider can't answer isn't asked about again on every request.  d
+// should be short so an outage doesn't stick.  These entries have
+// Provider "negative".  By default failures aren't cached.
+func WithNegativeTTL(d time.Duration) Option {
+	return func(l *GeoLocator) { l.negativeTTL = d }
+}
+
+// WithLookupTimeout bounds each GetGeoData call, cache and provider
+// together, and each IP of a GetGeoDataBatch.  A caller's shorter
+// deadline still wins.  0, the default, leaves it to the caller.
+func WithLookupTimeout(d time.Duration) Option {
+	return func(l *GeoLocator) { l.lookupTimeout = d }
+}
+
+// WithBaseContext makes ctx the parent of the locator's background work:
+// SWR refreshes and the lookups shared by concurrent misses.  Cancelling
+// it, e.g. on application shutdown, stops that work where it is rather
+// than letting it run out its timeout; misses after that fail with
+// context.Canceled.  It complements Close, which is still needed: Close
+// waits for the background work to finish and closes the connection,
+// cancelling ctx only makes the wait short.
+func WithBaseContext(ctx context.Context) Option {
+	return func(l *GeoLocator) { l.baseCtx = ctx }
+}
+
+// WithSynchronous runs everything in the caller's goroutine, for
+// deterministic tests and debugging: GetGeoDataBatch looks its misses up
+// one at a time, concurrent misses share a lookup without it being
+// detached from the first caller's ctx, an SWR refresh (see
+// WithStaleAfter) runs before the stale answer is returned, a lookup over
+// WithLatencyBudget is abandoned rather than finished in the background,
+// and failed cache writes aren't retried (see WithCacheWriteRetry).  It
+// is not meant for production use with large batches.
+func WithSynchronous(on bool) Option {
+	return func(l *GeoLocator) { l.synchronous = on }
+}
+
+// WithBatchWorkers caps how many provider lookups GetGeoDataBatch runs at
+// once.  The default is 8.
+func WithBatchWorkers(n int) Option {
+	return func(l *GeoLocator) { l.workers = n }
+}
+
+// NewGeoLocator builds a locator from opts.  Lookup results and errors go
+// to logger, or to rlog like the rest of the package if it is nil.  Call
+// Close when done with it.
+func NewGeoLocator(logger *slog.Logger, opts ...Option) *GeoLocator {
+	l := &GeoLocator{
+		logger:     logger,
+		redisAddr:  os.Getenv("REDIS_CONF"),
+		redisDB:    -1,
+		keyPrefix:  cacheKeyPrefix,
+		localNets:  localNetworks,
+		workers:    batchWorkers,
+		flight:     new(singleflight.Group),
+		tracer:     noopTracer,
+		httpClient: httpClient,
+		lookupURL:  lookupURL,
+	}
+	l.eventDrops = &l.counters.eventsDropped
+	stdCacheHealth.mu.Lock()
+	l.cacheHealth = newCacheHealth(stdCacheHealth.threshold, stdCacheHealth.retry)
+	stdCacheHealth.mu.Unlock()
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.httpClient == nil {
+		l.httpClient = httpClient
+	}
+	if l.httpTimeout != nil {
+		c := *l.httpClient
+		c.Timeout = *l.httpTimeout
+		l.httpClient = &c
+	}
+	if l.expvar {
+		l.publishExpvar()
+	}
+	if len(l.providers) == 0 {
+		l.providers = []Provider{&GeoIPLookupProvider{Client: l.httpClient, URL: l.lookupURL}}
+	}
+	for range l.providers {
+		l.breakers = append(l.breakers, newCircuitBreaker(l.breakerPolicy))
+	}
+	if l.cache == nil && l.redisClient != nil {
+		c := NewRedisCache(l.redisClient)
+		c.prefix = l.keyPrefix
+		l.cache = c
+	}
+	if l.cache == nil && (l.redisAddr != "" || l.redisConfig != nil) {
+		var client redis.UniversalClient
+		if l.redisConfig != nil {
+			client = NewRedisClient(*l.redisConfig)
+		} else {
+			client = newRedisClient(l.redisAddr, l.redisDB)
+		}
+		c := NewRedisCache(client)
+		c.prefix = l.keyPrefix
+		l.cache = c
+		l.ownsCache = c.client
+	}
+	l.rcache, _ = l.cache.(*RedisCache)
+	if l.cache != nil {
+		l.cache = &degradingCache{Cache: l.cache, health: l.cacheHealth}
+	}
+	if l.cache != nil && l.writeRetrySize > 0 && !l.synchronous {
+		l.writes = newWriteQueue(l.cache, l.writeRetrySize, l.writeRetryWindow, &l.counters.writesDropped, l.spawn)
+		l.cache = &retryingCache{Cache: l.cache, queue: l.writes}
+	}
+	if l.cache != nil && l.latencyBudget > 0 {
+		l.stale = &staleCache{Cache: l.cache, keep: l.staleKeep}
+		l.cache = l.stale
+	}
+	if l.cache != nil && l.nearSize > 0 {
+		l.cache = NewTieredCache(l.cache, l.nearSize, l.nearTTL)
+	}
+	if l.warmup {
+		l.startWarmup()
+	}
+	return l
+}
+
+var stdFlight singleflight.Group
+
+// std is the locator behind the package-level functions.  It is built
+// from the package settings on each call so they can still be changed.
+func std() *GeoLocator {
+	l := &GeoLocator{
+		providers:       []Provider{&GeoIPLookupProvider{}},
+		workers:         batchWorkers,
+		localNets:       localNetworks,
+		testIP:          testIP,
+		testIPData:      testIPData,
+		eventCh:         eventCh,
+		eventDropIfFull: eventDropIfFull,
+		eventDrops:      &eventDrops,
+		cacheHealth:     stdCacheHealth,
+		flight:          &stdFlight,
+		tracer:          noopTracer,
+	}
+	if rules := overrides.Load(); rules != nil {
+		l.overrides = *rules
+	}
+	if redis_addr != "" {
+		l.rcache = NewRedisCache(redisClient)
+		l.cache = &degradingCache{Cache: l.rcache, health: stdCacheHealth}
+		if stdNear != nil {
+			l.cache = &TieredCache{near: stdNear, far: l.cache, nearTTL: stdNearTTL}
+		}
+	}
+	return l
+}
+
+// Close stops background refreshes from starting, waits for those and
+// any lookups shared by concurrent misses still running, then shuts down
+// the locator's Redis connection, after a last try at any cache writes
+// WithCacheWriteRetry still has queued.  To cut the wait short, cancel
+// WithBaseContext's context first.  A cache or client passed in with
+// WithCache or WithRedisClient is left open.  It is safe to call more
+// than once; later calls return the first one's result.  Lookups after
+// Close miss the cache.
+func (l *GeoLocator) Close() error {
+	l.closeOnce.Do(func() {
+		l.lifeMu.Lock()
+		l.closed = true
+		l.lifeMu.Unlock()
+		l.refreshes.Wait()
+		if l.writes != nil {
+			l.writes.close()
+		}
+		if l.ownsCache != nil {
+			l.closeErr = l.ownsCache.Close()
+		}
+	})
+	return l.closeErr
+}
+
+// startBackground counts a background task in, for Close to wait on.  It
+// is false once the locator is closing.
+func (l *GeoLocator) startBackground() bool {
+	l.lifeMu.Lock()
+	defer l.lifeMu.Unlock()
+	if l.closed {
+		return false
+	}
+	l.refreshes.Add(1)
+	return true
+}
+
+// backgroundContext is the context for work that outlives its caller: it
+// keeps parent's values, e.g. the trace, but not its cancellation, and
+// ends after timeout or when WithBaseContext's context does.
+func (l *GeoLocator) backgroundContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(parent), timeout)
+	if l.baseCtx == nil {
+		return ctx, cancel
+	}
+	stop := context.AfterFunc(l.baseCtx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+// GetGeoData initializes a search for the geoLocation of an IP, see the
+// package-level GetGeoDataContext for the errors.  ctx bounds the cache and
+// provider calls and carries the trace, see WithTracerProvider.  When it
+// runs out, the answer is what was found so far with ctx's error.
+func (l *GeoLocator) GetGeoData(ctx context.Context, ip string) (GeoIPData, error) {
+	ctx, cancel := l.withLookupTimeout(ctx)
+	defer cancel()
+	ctx, span := l.tracer.Start(ctx, "geolocate.GetGeoData", trace.WithAttributes(attribute.String("geo.ip", logIP(ip))))
+	geo, err := l.getGeoData(ctx, ip)
+	endLookupSpan(span, geo)
+	return geo, err
+}
+
+func (l *GeoLocator) getGeoData(ctx context.Context, ip string) (GeoIPData, error) {
+	if l.testIP != "" && ip == l.testIP {
+		return l.testIPData, nil
+	}
+	if geo, ok := matchOverride(l.overrides, ip); ok {
+		l.metrics.answered(geo.Provider)
+		l.logResult(geo)
+		return geo, nil
+	}
+
+	geo := newGeoIPData(ip)
+
+	// garbage never goes to the provider
+	if _, ok := parseAddr(geo.IP); !ok {
+		geo.Provider = "invalid"
+		geo.Error = "Invalid IP address"
+		l.logResult(geo)
+		return geo, fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+	}
+
+	if l.cache == nil {
+		l.errorf("Warning: no cache - REDIS_CONF not set")
+		l.logResult(geo)
+		return geo, ErrNoCache
+	}
+
+	// using Redis?  check there first
+	_, cspan := l.tracer.Start(ctx, "geolocate.cache")
+	geo.CacheHit = geo.checkCache(ctx, l.cache, ip)
+	cspan.SetAttributes(attribute.Bool("geo.cache_hit", geo.CacheHit))
+	cspan.End()
+	if prefer := preferred(ctx); prefer != "" && geo.CacheHit && geo.Provider != prefer {
+		// only the preferred provider's answer will do
+		geo = newGeoIPData(ip)
+	}
+	if geo.CacheHit && l.tooCoarse(geo) {
+		geo = newGeoIPData(ip)
+	}
+	if geo.CacheHit && (!placeholderCountry(geo.CountryCode) || geo.Provider == providerNegative) {
+		l.cacheResult(true)
+		l.revalidateIfStale(geo)
+		l.logResult(geo)
+		if geo.Provider == providerNegative {
+			return geo, fmt.Errorf("%w: cached failure for IP: %s - %s", ErrUpstreamUnavailable, logIP(geo.IP), geo.Error)
+		}
+		return geo, nil
+	}
+
+	// if we get here, it's not found in the cache, or hasn't been updated by the geo api
+	l.cacheResult(false)
+	return l.resolveWithinBudget(ctx, geo)
+}
+
+// resolveOrCached is resolve, except that if it fails for an entry the
+// cache held, e.g. one the provider only partly answered, the cached
+// entry is returned with the error rather than a placeholder.
+func (l *GeoLocator) resolveOrCached(ctx context.Context, geo GeoIPData) (GeoIPData, error) {
+	res, err := l.resolve(ctx, geo)
+	if err != nil && geo.CacheHit {
+		geo.Error = res.Error
+		return geo, err
+	}
+	return res, err
+}
+
+// withLookupTimeout bounds ctx by WithLookupTimeout, if set.
+func (l *GeoLocator) withLookupTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if l.lookupTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, l.lookupTimeout)
+}
+
+// sharedLookupTimeout bounds a lookup shared by concurrent misses, see
+// resolve, unless WithLookupTimeout sets one.
+const sharedLookupTimeout = 30 * time.Second
+
+// resolve answers geo after a cache miss, caches and logs it.  Concurrent
+// misses for the same IP share one lookup.  It runs detached from any one
+// caller's ctx, so a caller giving up doesn't fail the others; each
+// caller stops waiting when its own ctx is done.  Close waits for it, and
+// WithBaseContext's context cancels it.
+func (l *GeoLocator) resolve(ctx context.Context, geo GeoIPData) (GeoIPData, error) {
+	shared := geo
+	key := geo.IP
+	if prefer := preferred(ctx); prefer != "" {
+		key = "prefer " + prefer + " " + geo.IP
+	}
+	if l.synchronous {
+		v, err, _ := l.flight.Do(key, func() (interface{}, error) {
+			err := l.resolveOnce(ctx, &shared)
+			return shared, err
+		})
+		return v.(GeoIPData), err
+	}
+	ch := l.flight.DoChan(key, func() (interface{}, error) {
+		timeout := l.lookupTimeout
+		if timeout <= 0 {
+			timeout = sharedLookupTimeout
+		}
+		if l.startBackground() {
+			defer l.refreshes.Done()
+		}
+		sctx, cancel := l.backgroundContext(ctx, timeout)
+		defer cancel()
+		err := l.resolveOnce(sctx, &shared)
+		return shared, err
+	})
+	select {
+	case res := <-ch:
+		return res.Val.(GeoIPData), res.Err
+	case <-ctx.Done():
+		geo.Error = ctx.Err().Error()
+		return geo, lookupError(ctx.Err())
+	}
+}
+
+func (l *GeoLocator) resolveOnce(ctx context.Context, geo *GeoIPData) error {
+	// is it a routable IP?  if not, no need to call the service.
+	// update GeoIPData, and add to cache
+	if geo.isLocalIn(l.localNets) || !geo.isRoutable() {
+		l.metrics.answered(geo.Provider)
+		geo.add2Cache(ctx, l.cache, l.currentTTL())
+		l.logResult(*geo)
+		if !geo.Routable && geo.Provider != "local" {
+			return fmt.Errorf("%w: %s is %s", ErrNonRoutable, logIP(geo.IP), geo.Provider)
+		}
+		return nil
+	}
+
+	if reverseDNS {
+		geo.lookupReverseDNS(ctx)
+	}
+
+	//ip should be routable, so call the location service
+	// a failed lookup isn't cached, so we try again next time, unless
+	// there's a negative TTL
+	if err := l.lookup(ctx, geo); err != nil {
+		l.errorf("GetGeoData lookup failed for IP: %s", logIP(geo.IP))
+		if l.negativeTTL > 0 && ctx.Err() == nil && !errors.Is(err, ErrRateLimited) && !errors.Is(err, ErrCircuitOpen) {
+			neg := *geo
+			neg.Provider = providerNegative
+			neg.add2Cache(ctx, l.cache, l.negativeTTL)
+			geo.EffectiveTTL = neg.EffectiveTTL
+		}
+		l.logResult(*geo)
+		return lookupError(err)
+	}
+	if l.asnDB != nil {
+		l.asnDB.enrichASN(geo)
+	}
+
+	geo.add2Cache(ctx, l.cache, l.currentTTL())
+	l.logResult(*geo)
+	return nil
+}
+
+// lookupError is an error from lookup as GetGeoData returns it.
+func lookupError(err error) error {
+	if errors.Is(err, ErrRateLimited) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", ErrUpstreamUnavailable, err)
+}
+
+// lookup asks each provider in turn about geo.IP until one locates it,
+// starting with ctx's PreferProvider if any.  The error is the last
+// provider's.
+func (l *GeoLocator) lookup(ctx context.Context, geo *GeoIPData) error {
+	prefer := preferred(ctx)
+	var err error
+	var last Provider
+	for _, i := range l.providerOrder(prefer) {
+		p := l.providers[i]
+		if last != nil {
+			l.warnf("GetGeoData failing over from %s to %s for IP: %s - %s", last.Name(), p.Name(), logIP(geo.IP), redactErr(err, geo.IP))
+			geo.Error = ""
+		}
+		if err = l.lookupRetrying(ctx, p, l.breaker(i), geo); err == nil {
+			geo.Degraded = prefer != "" && p.Name() != prefer
+			geo.CountryOnly = l.countryOnly
+			return nil
+		}
+		if errors.Is(err, ErrRateLimited) {
+			return err
+		}
+		last = p
+	}
+	return err
+}
+
+// lookupRetrying is one provider's attempts at geo.IP, see WithRetry.
+func (l *GeoLocator) lookupRetrying(ctx context.Context, p Provider, b *circuitBreaker, geo *GeoIPData) error {
+	for attempt := 1; ; attempt++ {
+		if err := l.allow(ctx); err != nil {
+			geo.Success = false
+			geo.Error = err.Error()
+			return err
+		}
+		if !b.allow() {
+			geo.Success = false
+			geo.Error = ErrCircuitOpen.Error()
+			return ErrCircuitOpen
+		}
+		var status int
+		start := time.Now()
+		uctx, uspan := l.tracer.Start(ctx, "geolocate.upstream", trace.WithAttributes(
+			attribute.String("geo.provider", p.Name()),
+			attribute.Int("geo.attempt", attempt),
+		))
+		l.counters.inFlight.Add(1)
+		err := geo.lookupWith(withStatus(uctx, &status), l.validating(l.countryScoped(p)))
+		l.counters.inFlight.Add(-1)
+		if err != nil {
+			l.counters.providerErrors.Add(1)
+		}
+		b.record(err)
+		endUpstreamSpan(uspan, status, err)
+		l.metrics.upstream(p.Name(), time.Since(start), status, err)
+		if err == nil {
+			return nil
+		}
+		delay, ok := l.retry.backoff(attempt, err)
+		if !ok {
+			return err
+		}
+		l.warnf("GetGeoData retrying %s in %s for IP: %s - %s", p.Name(), delay, logIP(geo.IP), redactErr(err, geo.IP))
+		if sleep(ctx, delay) != nil {
+			return err
+		}
+		geo.Error = ""
+	}
+}
+
+// breaker is provider i's circuit breaker, nil if there is none.
+func (l *GeoLocator) breaker(i int) *circuitBreaker {
+	if i < len(l.breakers) {
+		return l.breakers[i]
+	}
+	return nil
+}
+
+func (l *GeoLocator) currentTTL() time.Duration {
+	if l.ttl > 0 {
+		return l.ttl
+	}
+	return currentTTL()
+}
+
+func (l *GeoLocator) errorf(format string, args ...interface{}) {
+	if l.logger == nil {
+		rlog.Errorf(format, args...)
+		return
+	}
+	l.logger.Error(fmt.Sprintf(format, args...))
+}
+
+func (l *GeoLocator) debugf(format string, args ...interface{}) {
+	if l.logger == nil {
+		rlog.Debugf(format, args...)
+		return
+	}
+	l.logger.Debug(fmt.Sprintf(format, args...))
+}
+
+func (l *GeoLocator) warnf(format string, args ...interface{}) {
+	if l.logger == nil {
+		rlog.Warnf(format, args...)
+		return
+	}
+	l.logger.Warn(fmt.Sprintf(format, args...))
+}
+
+// logResult is logGeo for this locator's logger.
+func (l *GeoLocator) logResult(geo GeoIPData) {
+	l.publishEvent(geo)
+	if l.logger == nil {
+		logGeo(geo)
+		return
+	}
+	l.logger.Log(context.Background(), slog.Level(resultLogLevel.Load()), "geo lookup", "result", redactIP(geo))
+}
@@ -0,0 +1,449 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestNewGeoLocatorOptions(t *testing.T) {
+	mr := miniredis.RunT(t)
+	var hits int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path != "/geo/8.8.8.8" {
+			t.Errorf("want: /geo/8.8.8.8\ngot: %s\n", r.URL.Path)
+		}
+		fmt.Fprint(w, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	}))
+	defer srv.Close()
+
+	l := NewGeoLocator(nil,
+		WithRedisAddr(mr.Addr()),
+		WithRedisDB(2),
+		WithTTL(time.Hour),
+		WithHTTPClient(srv.Client()),
+		WithLookupURL(srv.URL+"/geo/%s"),
+	)
+	defer l.Close()
+
+	geo, _ := l.GetGeoData(context.Background(), "8.8.8.8")
+	if geo.ISP != "Google LLC" || geo.EffectiveTTL != time.Hour {
+		t.Errorf("want: Google LLC 1h\ngot: %s %s\n", geo.ISP, geo.EffectiveTTL)
+	}
+	mr.Select(2)
+	if got := mr.TTL("geo:8.8.8.8"); got != time.Hour {
+		t.Errorf("db 2 ttl want: 1h\ngot: %s\n", got)
+	}
+
+	geo, _ = l.GetGeoData(context.Background(), "8.8.8.8")
+	if !geo.CacheHit || hits != 1 {
+		t.Errorf("want: cache hit, 1 provider call\ngot: %v, %d\n", geo.CacheHit, hits)
+	}
+}
+
+func TestNewGeoLocatorNoCache(t *testing.T) {
+	l := NewGeoLocator(nil, WithRedisAddr(""))
+	defer l.Close()
+
+	geo, _ := l.GetGeoData(context.Background(), "8.8.8.8")
+	if geo.CountryCode != "--" || geo.CacheHit {
+		t.Errorf("want: placeholder\ngot: %+v\n", geo)
+	}
+}
+
+func TestGeoLocatorIPv6(t *testing.T) {
+	var asked string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked = r.URL.Path
+		fmt.Fprint(w, `{"ip":"2001:4860:4860::8888","isp":"Google LLC","country_code":"US","success":true}`)
+	}))
+	defer srv.Close()
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"))
+
+	if geo, _ := l.GetGeoData(context.Background(), "2001:4860:4860::8888"); geo.ISP != "Google LLC" || asked != "/2001:4860:4860::8888" {
+		t.Errorf("want: provider asked about 2001:4860:4860::8888\ngot: %q %s\n", asked, geo.ISP)
+	}
+
+	asked = ""
+	if geo, _ := l.GetGeoData(context.Background(), "fd00::1"); geo.Provider != "non-routable" || asked != "" {
+		t.Errorf("want: fd00::1 non-routable, provider not asked\ngot: %s %q\n", geo.Provider, asked)
+	}
+}
+
+func TestGetGeoDataSingleflight(t *testing.T) {
+	useMiniredis(t)
+	var calls atomic.Int32
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		fmt.Fprint(w, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	}))
+	defer srv.Close()
+	oldURL := lookupURL
+	lookupURL = srv.URL + "/%s"
+	defer func() { lookupURL = oldURL }()
+
+	var wg sync.WaitGroup
+	results := make([]GeoIPData, 50)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i] = GetGeoData("8.8.8.8")
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	if n := calls.Load(); n != 1 {
+		t.Errorf("want: 1 provider call\ngot: %d\n", n)
+	}
+	for _, geo := range results {
+		if geo.ISP != "Google LLC" {
+			t.Errorf("want: Google LLC\ngot: %s\n", geo.ISP)
+			break
+		}
+	}
+}
+
+func TestWithNegativeTTL(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	mr := miniredis.RunT(t)
+	l := NewGeoLocator(nil, WithRedisAddr(mr.Addr()), WithLookupURL(srv.URL+"/%s"), WithNegativeTTL(5*time.Minute))
+	defer l.Close()
+
+	geo, _ := l.GetGeoData(context.Background(), "8.8.8.8")
+	if geo.Located || geo.EffectiveTTL != 5*time.Minute || mr.TTL("geo:8.8.8.8") != 5*time.Minute {
+		t.Errorf("want: failure cached for 5m\ngot: %v %s %s\n", geo.Located, geo.EffectiveTTL, mr.TTL("geo:8.8.8.8"))
+	}
+	geo, _ = l.GetGeoData(context.Background(), "8.8.8.8")
+	if !geo.CacheHit || geo.Provider != "negative" || calls.Load() != 1 {
+		t.Errorf("want: negative cache hit, 1 provider call\ngot: %v %s %d\n", geo.CacheHit, geo.Provider, calls.Load())
+	}
+
+	mr.FastForward(6 * time.Minute)
+	l.GetGeoData(context.Background(), "8.8.8.8")
+	if calls.Load() != 2 {
+		t.Errorf("want: provider asked again after the negative TTL\ngot: %d calls\n", calls.Load())
+	}
+}
+
+func TestWithLocalNetworks(t *testing.T) {
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLocalNetworks([]LocalNetRule{
+		{CIDR: "bogus"},
+		{CIDR: "10.20.0.0/16", ISP: "Acme HQ", City: "Denver", Country: "US"},
+	}))
+	defer l.Close()
+
+	geo, _ := l.GetGeoData(context.Background(), "10.20.3.4")
+	if geo.Provider != "local" || geo.ISP != "Acme HQ" || geo.City != "Denver" || geo.CountryCode != "US" {
+		t.Errorf("want: local Acme HQ Denver US\ngot: %s %s %s %s\n", geo.Provider, geo.ISP, geo.City, geo.CountryCode)
+	}
+	// the default rule no longer applies
+	if geo, _ := l.GetGeoData(context.Background(), "192.168.106.99"); geo.Provider != "non-routable" {
+		t.Errorf("want: non-routable\ngot: %s %s\n", geo.Provider, geo.ISP)
+	}
+}
+
+func TestWithTestIP(t *testing.T) {
+	SetTestIP("203.0.113.78", GeoIPData{ISP: "Package ISP"})
+	defer SetTestIP("", GeoIPData{})
+
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL("http://127.0.0.1:1/%s"),
+		WithTestIP("203.0.113.77", GeoIPData{ISP: "Test ISP", CountryCode: "NZ"}))
+	defer l.Close()
+	ctx := context.Background()
+
+	geo, err := l.GetGeoData(ctx, "203.0.113.77")
+	if err != nil || geo.ISP != "Test ISP" || geo.IP != "203.0.113.77" {
+		t.Errorf("want: Test ISP 203.0.113.77\ngot: %s %s %v\n", geo.ISP, geo.IP, err)
+	}
+	geos, _ := l.GetGeoDataBatch(ctx, []string{"203.0.113.77"})
+	if geos[0].ISP != "Test ISP" {
+		t.Errorf("batch want: Test ISP\ngot: %s\n", geos[0].ISP)
+	}
+	// the package setting is for the package-level functions only
+	if geo, _ := l.GetGeoData(ctx, "203.0.113.78"); geo.ISP == "Package ISP" {
+		t.Errorf("want SetTestIP ignored\ngot: %s\n", geo.ISP)
+	}
+}
+
+func TestSetLocalNetworks(t *testing.T) {
+	useMiniredis(t)
+	t.Cleanup(func() { SetLocalNetworks(defaultLocalNetworks) })
+
+	if err := SetLocalNetworks([]LocalNetRule{{CIDR: "nope"}}); err == nil {
+		t.Errorf("want: an error\ngot: nil\n")
+	}
+	if geo := GetGeoData("192.168.106.99"); geo.ISP != "LaughingJ" {
+		t.Errorf("default want: LaughingJ\ngot: %s\n", geo.ISP)
+	}
+	if err := SetLocalNetworks([]LocalNetRule{{CIDR: "fd00:1::/32", ISP: "Lab", Country: "DE"}}); err != nil {
+		t.Fatal(err)
+	}
+	if geo := GetGeoData("fd00:1::7"); geo.Provider != "local" || geo.ISP != "Lab" {
+		t.Errorf("want: local Lab\ngot: %s %s\n", geo.Provider, geo.ISP)
+	}
+}
+
+func TestGetGeoDataErrors(t *testing.T) {
+	var asked atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		asked.Add(1)
+		if r.URL.Path == "/1.1.1.1" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"isp":"Google LLC","country_code":"US","success":true}`)
+	}))
+	defer srv.Close()
+
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"), WithNegativeTTL(time.Minute))
+	defer l.Close()
+	ctx := context.Background()
+
+	tests := []struct {
+		ip   string
+		want error
+	}{
+		{"8.8.8.8", nil},
+		{"192.168.106.7", nil},
+		{"not-an-ip", ErrInvalidIP},
+		{"10.0.0.1", ErrNonRoutable},
+		{"192.0.2.1", ErrNonRoutable},
+		{"1.1.1.1", ErrUpstreamUnavailable},
+		{"1.1.1.1", ErrUpstreamUnavailable}, // the cached failure
+	}
+	for _, tt := range tests {
+		_, err := l.GetGeoData(ctx, tt.ip)
+		if (tt.want == nil && err != nil) || !errors.Is(err, tt.want) {
+			t.Errorf("%s want: %v\ngot: %v\n", tt.ip, tt.want, err)
+		}
+	}
+	if asked.Load() != 2 {
+		t.Errorf("want: only 8.8.8.8 and 1.1.1.1 sent to the provider\ngot: %d calls\n", asked.Load())
+	}
+
+	limited := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"), WithRateLimit(0.001, 1), WithRateLimitReject())
+	defer limited.Close()
+	limited.GetGeoData(ctx, "8.8.8.8")
+	if _, err := limited.GetGeoData(ctx, "8.8.4.4"); !errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("want: ErrRateLimited\ngot: %v\n", err)
+	}
+
+	if _, err := NewGeoLocator(nil, WithRedisAddr("")).GetGeoData(ctx, "8.8.8.8"); !errors.Is(err, ErrNoCache) {
+		t.Errorf("want: ErrNoCache\ngot: %v\n", err)
+	}
+}
+
+func TestWithLookupTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	mem := NewMemoryCache(10)
+	// cached, but the provider only got as far as the ISP
+	mem.Set(ctx, "1.1.1.1", GeoIPData{IP: "1.1.1.1", ISP: "Cloudflare, Inc.", CountryCode: "--", Routable: true}, 0)
+	l := NewGeoLocator(nil, WithCache(mem), WithLookupURL(srv.URL+"/%s"), WithLookupTimeout(20*time.Millisecond))
+	defer l.Close()
+
+	start := time.Now()
+	geo, err := l.GetGeoData(ctx, "8.8.8.8")
+	if !errors.Is(err, context.DeadlineExceeded) || geo.IP != "8.8.8.8" {
+		t.Errorf("want: 8.8.8.8 with DeadlineExceeded\ngot: %s %v\n", geo.IP, err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("want: gave up after 20ms\ngot: %s\n", d)
+	}
+
+	geo, err = l.GetGeoData(ctx, "1.1.1.1")
+	if err == nil || !geo.CacheHit || geo.ISP != "Cloudflare, Inc." {
+		t.Errorf("want: cached partial answer with an error\ngot: %v %s %v\n", geo.CacheHit, geo.ISP, err)
+	}
+
+	results, _ := l.GetGeoDataBatch(ctx, []string{"1.1.1.1", "9.9.9.9"})
+	if results[0].ISP != "Cloudflare, Inc." || results[1].IP != "9.9.9.9" || results[1].Error == "" {
+		t.Errorf("want: cached partial answer, then a timed out lookup\ngot: %+v\n", results)
+	}
+}
+
+func TestResolveSharedCancel(t *testing.T) {
+	hit := make(chan struct{}, 1)
+	release := make(chan struct{})
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		hit <- struct{}{}
+		<-release
+		fmt.Fprint(w, `{"isp":"Google LLC","country_code":"US","success":true}`)
+	}))
+	defer srv.Close()
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"))
+	defer l.Close()
+
+	type result struct {
+		geo GeoIPData
+		err error
+	}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	first := make(chan result)
+	go func() {
+		geo, err := l.GetGeoData(ctx1, "8.8.8.8")
+		first <- result{geo, err}
+	}()
+	<-hit
+	second := make(chan result)
+	go func() {
+		geo, err := l.GetGeoData(context.Background(), "8.8.8.8")
+		second <- result{geo, err}
+	}()
+	time.Sleep(20 * time.Millisecond) // let the second caller join the lookup
+
+	cancel1()
+	if r := <-first; !errors.Is(r.err, context.Canceled) {
+		t.Errorf("first caller want: context.Canceled\ngot: %v\n", r.err)
+	}
+	close(release)
+	if r := <-second; r.err != nil || r.geo.ISP != "Google LLC" {
+		t.Errorf("second caller want: Google LLC\ngot: %s %v\n", r.geo.ISP, r.err)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("want: 1 shared provider call\ngot: %d\n", hits.Load())
+	}
+}
+
+func TestWithBaseContext(t *testing.T) {
+	hit := make(chan struct{}, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hit <- struct{}{}
+		<-r.Context().Done() // never answers on its own
+	}))
+	defer srv.Close()
+	base, shutdown := context.WithCancel(context.Background())
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"), WithBaseContext(base))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-hit
+		cancel() // the caller gives up, the shared lookup carries on
+	}()
+	if _, err := l.GetGeoData(ctx, "8.8.8.8"); !errors.Is(err, context.Canceled) {
+		t.Errorf("want: context.Canceled\ngot: %v\n", err)
+	}
+
+	shutdown()
+	closed := make(chan struct{})
+	go func() {
+		l.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("want: Close to return once the base context is cancelled\ngot: still waiting\n")
+	}
+}
+
+// deadlineCache is a MemoryCache that records whether writes were bounded.
+type deadlineCache struct {
+	*MemoryCache
+	bounded atomic.Bool
+}
+
+func (c *deadlineCache) Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error {
+	_, ok := ctx.Deadline()
+	c.bounded.Store(ok)
+	return c.MemoryCache.Set(ctx, key, geo, ttl)
+}
+
+func TestLookupTimeoutBoundsCacheWrites(t *testing.T) {
+	url := providerServer(t, `{"isp":"Google LLC","country_code":"US","success":true}`, nil)
+	c := &deadlineCache{MemoryCache: NewMemoryCache(10)}
+	l := NewGeoLocator(nil, WithCache(c), WithLookupURL(url+"/%s"), WithLookupTimeout(time.Second))
+	defer l.Close()
+	ctx := context.Background()
+
+	l.GetGeoData(ctx, "8.8.8.8")
+	if !c.bounded.Load() {
+		t.Errorf("lookup want: cache write with a deadline\ngot: none\n")
+	}
+	c.bounded.Store(false)
+	tctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	l.Refresh(tctx, "8.8.8.8")
+	if !c.bounded.Load() {
+		t.Errorf("Refresh want: cache write with the caller's deadline\ngot: none\n")
+	}
+}
+
+// staticProvider answers every IP with the same record, at no cost, so
+// benchmarks measure the locator rather than a provider.
+type staticProvider struct{}
+
+func (staticProvider) Name() string { return "static" }
+
+func (staticProvider) Lookup(ctx context.Context, geo *GeoIPData) error {
+	geo.ISP, geo.CountryCode, geo.City, geo.Success = "Static ISP", "US", "Wichita", true
+	return nil
+}
+
+func benchLocator(b *testing.B) *GeoLocator {
+	b.Helper()
+	l := NewGeoLocator(slog.New(slog.NewTextHandler(io.Discard, nil)),
+		WithCache(NewMemoryCache(1<<20)), WithProvider(staticProvider{}))
+	b.Cleanup(func() { l.Close() })
+	return l
+}
+
+func BenchmarkGetGeoData_CacheHit(b *testing.B) {
+	l := benchLocator(b)
+	ctx := context.Background()
+	l.GetGeoData(ctx, "8.8.8.8")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if geo, _ := l.GetGeoData(ctx, "8.8.8.8"); !geo.CacheHit {
+			b.Fatal("want: a cache hit")
+		}
+	}
+}
+
+func BenchmarkGetGeoData_Miss(b *testing.B) {
+	l := benchLocator(b)
+	ctx := context.Background()
+	ips := make([]string, b.N)
+	for i := range ips {
+		ips[i] = netip.AddrFrom4([4]byte{8, byte(i >> 16), byte(i >> 8), byte(i)}).String()
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if geo, _ := l.GetGeoData(ctx, ips[i]); geo.CacheHit {
+			b.Fatal("want: a miss")
+		}
+	}
+}
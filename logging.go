@@ -0,0 +1,105 @@
+package me_geolocate
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"strings"
+
+	"github.com/romana/rlog"
+)
+
+var logIPSalt []byte // see SetLogIPHash
+
+// SetLogIPHash pseudonymizes IPs in our log output: each one is replaced by
+// a truncated HMAC-SHA256 of the address keyed with salt.  Lookups and the
+// cache still use the real IP.  The salt must stay the same across runs
+// and instances, or the same IP won't correlate between log lines.  An
+// empty salt goes back to logging raw IPs.
+func SetLogIPHash(salt string) {
+	logIPSalt = []byte(salt)
+}
+
+// logIP is how ip should appear in log output.
+func logIP(ip string) string {
+	if len(logIPSalt) == 0 {
+		return ip
+	}
+	mac := hmac.New(sha256.New, logIPSalt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// SetResultLogLevel sets the level lookup results are logged at (Info by
+// default), so they can be quietened to Debug or raised while
+// investigating.  It is safe to call at any time.
+func SetResultLogLevel(l slog.Level) {
+	resultLogLevel.Store(int64(l))
+}
+
+// logGeo logs the outcome of a lookup.
+func logGeo(geo GeoIPData) {
+	geo = redactIP(geo)
+
+	switch l := slog.Level(resultLogLevel.Load()); {
+	case l < slog.LevelInfo:
+		rlog.Debugf("%+v\n", geo)
+	case l < slog.LevelWarn:
+		rlog.Infof("%+v\n", geo)
+	case l < slog.LevelError:
+		rlog.Warnf("%+v\n", geo)
+	default:
+		rlog.Errorf("%+v\n", geo)
+	}
+}
+
+// redactIP swaps geo's IP for its logIP form, including where the IP
+// appears in the error message.
+func redactIP(geo GeoIPData) GeoIPData {
+	if len(logIPSalt) > 0 && geo.IP != "" {
+		geo.Error = redactText(geo.Error, geo.IP)
+		geo.IP = logIP(geo.IP)
+	}
+	return geo
+}
+
+// redactErr is err's message for a log line about ip, see redactText.
+func redactErr(err error, ip string) string {
+	if err == nil {
+		return "<nil>"
+	}
+	return redactText(err.Error(), ip)
+}
+
+// redactText replaces ip in s with its logIP form, along with the
+// in-addr.arpa or ip6.arpa name a failed reverse DNS lookup mentions.
+func redactText(s, ip string) string {
+	if len(logIPSalt) == 0 || ip == "" {
+		return s
+	}
+	hashed := logIP(ip)
+	if addr, ok := parseAddr(ip); ok {
+		s = strings.ReplaceAll(s, arpaName(addr), hashed)
+		s = strings.ReplaceAll(s, addr.String(), hashed)
+	}
+	return strings.ReplaceAll(s, ip, hashed)
+}
+
+// arpaName is addr's reverse DNS name, without the trailing dot.
+func arpaName(addr netip.Addr) string {
+	var b strings.Builder
+	if addr.Is4() {
+		a := addr.As4()
+		fmt.Fprintf(&b, "%d.%d.%d.%d.in-addr.arpa", a[3], a[2], a[1], a[0])
+		return b.String()
+	}
+	a := addr.As16()
+	for i := len(a) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", a[i]&0xf, a[i]>>4)
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
@@ -0,0 +1,80 @@
+package me_geolocate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogIP(t *testing.T) {
+	if got := logIP("8.8.8.8"); got != "8.8.8.8" {
+		t.Errorf("want: 8.8.8.8\ngot: %s\n", got)
+	}
+
+	SetLogIPHash("pepper")
+	defer SetLogIPHash("")
+
+	got := logIP("8.8.8.8")
+	if got == "8.8.8.8" || len(got) != 16 {
+		t.Errorf("want a 16 char hash\ngot: %s\n", got)
+	}
+	if again := logIP("8.8.8.8"); again != got {
+		t.Errorf("want stable hash %s\ngot: %s\n", got, again)
+	}
+	if other := logIP("8.8.4.4"); other == got {
+		t.Errorf("want different IPs to hash differently\ngot: %s for both\n", got)
+	}
+
+	SetLogIPHash("salt")
+	if salted := logIP("8.8.8.8"); salted == got {
+		t.Errorf("want the salt to change the hash\ngot: %s for both\n", got)
+	}
+}
+
+func TestLogIPHashErrors(t *testing.T) {
+	SetLogIPHash("pepper")
+	defer SetLogIPHash("")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	var out bytes.Buffer
+	l := NewGeoLocator(slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})),
+		WithCache(NewMemoryCache(10)),
+		WithProviderChain(&IPAPIProvider{URL: srv.URL + "/%s"}, &IPInfoProvider{URL: srv.URL + "/%s/json"}),
+		WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}))
+	defer l.Close()
+	l.GetGeoData(context.Background(), "8.8.8.8")
+
+	if !strings.Contains(out.String(), "retrying") || !strings.Contains(out.String(), "failing over") {
+		t.Fatalf("want: retry and failover logged\ngot: %s\n", out.String())
+	}
+	if strings.Contains(out.String(), "8.8.8.8") {
+		t.Errorf("want: no raw IP in the log\ngot: %s\n", out.String())
+	}
+	if !strings.Contains(out.String(), logIP("8.8.8.8")) {
+		t.Errorf("want: %s in the log\ngot: %s\n", logIP("8.8.8.8"), out.String())
+	}
+
+	// a failed PTR lookup names the IP in reverse
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			return nil, errors.New("stub dialer")
+		},
+	}
+	for _, ip := range []string{"1.2.3.4", "2001:db8::1"} {
+		_, err := r.LookupAddr(context.Background(), ip)
+		if got := redactErr(err, ip); !strings.Contains(err.Error(), "arpa") || strings.Contains(got, "arpa") || !strings.Contains(got, logIP(ip)) {
+			t.Errorf("%s want: the arpa name hashed\ngot: %s -> %s\n", ip, err, got)
+		}
+	}
+}
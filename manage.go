@@ -0,0 +1,79 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrNoCache is returned by cache management calls on a locator without a
+// cache.
+var ErrNoCache = errors.New("me_geolocate: no cache configured")
+
+// Invalidate drops the cached entry for ip, so the next lookup asks the
+// provider.  It is not an error if there was none.
+func Invalidate(ctx context.Context, ip string) error {
+	return std().Invalidate(ctx, ip)
+}
+
+// Refresh looks ip up again, ignoring the cache, and overwrites the cached
+// entry with the answer.  If the provider fails the cached entry is left
+// alone and the error returned.
+func Refresh(ctx context.Context, ip string) (GeoIPData, error) {
+	return std().Refresh(ctx, ip)
+}
+
+// Warm looks up every IP in ips that isn't already cached, e.g. before
+// traffic arrives or after a cache flush, see GetGeoDataBatch.
+func Warm(ctx context.Context, ips []string) error {
+	return std().Warm(ctx, ips)
+}
+
+// Invalidate is the package-level Invalidate for this locator's cache.
+func (l *GeoLocator) Invalidate(ctx context.Context, ip string) error {
+	if l.cache == nil {
+		return ErrNoCache
+	}
+	if net.ParseIP(ip) == nil {
+		return fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+	}
+	return l.cache.Delete(ctx, cacheKey(ip))
+}
+
+// Refresh is the package-level Refresh for this locator.
+func (l *GeoLocator) Refresh(ctx context.Context, ip string) (GeoIPData, error) {
+	geo := newGeoIPData(ip)
+	if l.cache == nil {
+		return geo, ErrNoCache
+	}
+	if net.ParseIP(geo.IP) == nil {
+		return geo, fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+	}
+	if geo.isLocalIn(l.localNets) || !geo.isRoutable() {
+		geo.add2Cache(ctx, l.cache, l.currentTTL())
+		return geo, nil
+	}
+
+	if reverseDNS {
+		geo.lookupReverseDNS(ctx)
+	}
+	if err := l.lookup(ctx, &geo); err != nil {
+		return geo, lookupError(err)
+	}
+	if l.asnDB != nil {
+		l.asnDB.enrichASN(&geo)
+	}
+	geo.add2Cache(ctx, l.cache, l.currentTTL())
+	l.logResult(geo)
+	return geo, nil
+}
+
+// Warm is the package-level Warm for this locator.
+func (l *GeoLocator) Warm(ctx context.Context, ips []string) error {
+	if l.cache == nil {
+		return ErrNoCache
+	}
+	_, err := l.GetGeoDataBatch(ctx, ips)
+	return err
+}
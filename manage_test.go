@@ -0,0 +1,85 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestInvalidateRefreshWarm(t *testing.T) {
+	var hits atomic.Int32
+	isp := "Google LLC"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprintf(w, `{"isp":%q,"country_code":"US","success":true}`, isp)
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	mem := NewMemoryCache(10)
+	l := NewGeoLocator(nil, WithCache(mem), WithLookupURL(srv.URL+"/%s"))
+	defer l.Close()
+
+	if err := l.Warm(ctx, []string{"8.8.8.8", "1.1.1.1", "8.8.8.8"}); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 2 || mem.Len() != 2 {
+		t.Errorf("want: 2 fetched, 2 cached\ngot: %d %d\n", hits.Load(), mem.Len())
+	}
+	l.Warm(ctx, []string{"8.8.8.8"})
+	if hits.Load() != 2 {
+		t.Errorf("want: cached IP not fetched again\ngot: %d provider calls\n", hits.Load())
+	}
+
+	isp = "Google LLC 2"
+	geo, err := l.Refresh(ctx, "8.8.8.8")
+	if err != nil || geo.ISP != "Google LLC 2" {
+		t.Errorf("want: Google LLC 2\ngot: %s %v\n", geo.ISP, err)
+	}
+	if geo, _ := l.GetGeoData(ctx, "8.8.8.8"); !geo.CacheHit || geo.ISP != "Google LLC 2" {
+		t.Errorf("want: refreshed entry cached\ngot: %v %s\n", geo.CacheHit, geo.ISP)
+	}
+
+	if err := l.Invalidate(ctx, "1.1.1.1"); err != nil {
+		t.Fatal(err)
+	}
+	if geo, _ := l.GetGeoData(ctx, "1.1.1.1"); geo.CacheHit {
+		t.Errorf("want: miss after Invalidate\ngot: hit\n")
+	}
+
+	if err := l.Invalidate(ctx, "nope"); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("want: ErrInvalidIP\ngot: %v\n", err)
+	}
+}
+
+func TestRefreshKeepsEntryOnFailure(t *testing.T) {
+	ctx := context.Background()
+	mem := NewMemoryCache(10)
+	mem.Set(ctx, "8.8.8.8", GeoIPData{IP: "8.8.8.8", ISP: "Google LLC", CountryCode: "US"}, 0)
+	url := providerServer(t, `{"success":false,"error":"quota exceeded"}`, nil)
+	l := NewGeoLocator(nil, WithCache(mem), WithLookupURL(url+"/%s"))
+	defer l.Close()
+
+	if _, err := l.Refresh(ctx, "8.8.8.8"); err == nil {
+		t.Errorf("want: an error\ngot: nil\n")
+	}
+	if geo, _ := mem.Get(ctx, "8.8.8.8"); geo.ISP != "Google LLC" {
+		t.Errorf("want: old entry kept\ngot: %+v\n", geo)
+	}
+}
+
+func TestManageNoCache(t *testing.T) {
+	l := NewGeoLocator(nil, WithRedisAddr(""))
+	defer l.Close()
+
+	if err := l.Invalidate(context.Background(), "8.8.8.8"); !errors.Is(err, ErrNoCache) {
+		t.Errorf("want: ErrNoCache\ngot: %v\n", err)
+	}
+	if err := l.Warm(context.Background(), []string{"8.8.8.8"}); !errors.Is(err, ErrNoCache) {
+		t.Errorf("want: ErrNoCache\ngot: %v\n", err)
+	}
+}
@@ -3,20 +3,34 @@
 // And finally, on a miss to cache, it makes a call to
 // https://json.geoiplookup.io/8.8.8.8 for the data and adds the data to the cache for next time
 // entrypoint: func GetGeoData(ip string) returns  GeoIPData struct
+//
+// NewGeoLocator builds a locator configured in code rather than from
+// REDIS_CONF.
+//
+// SetTTL and SetResultLogLevel may be called at any time while lookups are
+// running.  The other Set* functions are startup configuration and should be
+// called before the first lookup.
 package me_geolocate
 
 import (
-	"compress/gzip"
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
+	"net/netip"
+	"net/url"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/go-redis/redis/v8"
+	"github.com/redis/go-redis/v9"
 	"github.com/romana/rlog"
 )
 
@@ -48,24 +62,62 @@ type GeoIPData struct {
 	Error          string  `json:"error"`
 	Premium        bool    `json:"premium"`
 	//my fields
-	Located  bool `json:"located"`
-	Routable bool `json:"routable"`
-	Block    bool
-	CacheHit bool
+	Located    bool      `json:"located"`
+	Routable   bool      `json:"routable"`
+	Provider   string    `json:"provider"`    // who answered: provider name, "local", "non-routable", "reserved", "override", "negative", "stale_timeout" or "cache"
+	ReverseDNS string    `json:"reverse_dns"` // PTR name, see SetReverseDNS
+	FetchedAt  time.Time `json:"fetched_at"`  // when the provider answered, zero if it didn't
+	// only the country was asked for, so City and the rest are empty
+	// rather than unknown, see WithCountryOnly
+	CountryOnly bool `json:"country_only"`
+	Block       bool
+	CacheHit    bool
+	// TTL this result was cached with, 0 if it wasn't written. Not cached itself.
+	EffectiveTTL time.Duration `json:"-"`
+	// provider response headers picked by SetProviderHeaders. Not cached.
+	ProviderHeaders map[string]string `json:"-"`
+	// the provider asked for with PreferProvider failed and another
+	// answered. Not cached.
+	Degraded bool `json:"-"`
 }
 
-const ttl int = 129600 // 90 days in minutes  60*24*90
-var redisClient *redis.Client
-var redis_addr string
+const providerName = "geoiplookup.io"
+const providerNegative = "negative" // a cached failure, see WithNegativeTTL
+
+const ttl int = 129600          // 90 days in minutes  60*24*90, see SetTTL
+var cacheTTL atomic.Int64       // nanoseconds, 0 = ttl
+var resultLogLevel atomic.Int64 // slog.Level for logGeo
+var minTTL int                  // cache writes below this many minutes are skipped, 0 = no floor
+var unknownCC = "--"            // CountryCode placeholder, see SetUnknownCountry
+var testIP string               // see SetTestIP
+var testIPData GeoIPData
+var providerFields map[string]bool // json names the provider may set, nil = all
+var providerHeaders []string       // response headers to capture, see SetProviderHeaders
+var redisClient redis.UniversalClient
+var redisOwned bool   // redisClient was built from REDIS_CONF
+var redis_addr string // REDIS_CONF, or describes a SetRedisClient client; "" = no cache
+
+// every provider call goes to the same host, so keep plenty of idle
+// connections to it around - the stock 2 per host churns under load
+var providerTransport = &http.Transport{
+	Proxy:               http.ProxyFromEnvironment,
+	MaxIdleConns:        100,
+	MaxIdleConnsPerHost: 100,
+	IdleConnTimeout:     90 * time.Second,
+	TLSHandshakeTimeout: 10 * time.Second,
+}
+
+// providerTimeout bounds a whole provider call, see SetProviderTimeout.
+const providerTimeout = 15 * time.Second
+
+var httpClient = &http.Client{Transport: providerTransport, Timeout: providerTimeout}
+var lookupURL = "https://json.geoiplookup.io/%s"
 
 func init() {
 	redis_addr = os.Getenv("REDIS_CONF")
 	var ctx = context.Background()
-	redisClient = redis.NewClient(&redis.Options{
-		Addr:     redis_addr,
-		Password: "",
-		DB:       0,
-	})
+	redisClient = newRedisClient(redis_addr, -1)
+	redisOwned = true
 	pong, err := redisClient.Ping(ctx).Result()
 	if err != nil {
 		//do something - probably set environment variable
@@ -73,38 +125,303 @@ func init() {
 	rlog.Printf("%+v\n", pong)
 }
 
-func (g *GeoIPData) checkRedisCache(redisClient *redis.Client, ip string) bool {
-	var ctx = context.Background()
+// SetRedisClient makes the package-level functions cache through c, e.g.
+// a client the application already has, instead of the one built from
+// REDIS_CONF, which is closed.  nil turns the cache off.  Closing c is up
+// to the caller.
+func SetRedisClient(c redis.UniversalClient) {
+	if redisOwned && redisClient != c {
+		redisClient.Close()
+	}
+	redisClient, redis_addr, redisOwned = c, "", false
+	if c != nil {
+		redis_addr = fmt.Sprint(c)
+	}
+}
 
-	jsonResult, err := redisClient.Get(ctx, ip).Result()
-	if err == redis.Nil {
-		g.Located = false
-		return false
+// newRedisClient builds the cache client from REDIS_CONF and the other
+// REDIS_* variables, see redisConfigFromEnv.  A db of 0 or more overrides
+// the DB from the URLs.
+func newRedisClient(conf string, db int) redis.UniversalClient {
+	cfg := redisConfigFromEnv(conf)
+	cfg.DB = db
+	return NewRedisClient(cfg)
+}
+
+// newShardedClient connects to addrs.  More than one shards the cache
+// across those Redis instances, using consistent hashing on the key so
+// reads and writes for an IP land on the same shard.  A shard that is
+// down turns its keys into misses rather than failing lookups.
+func newShardedClient(cfg RedisConfig) redis.UniversalClient {
+	shards := make(map[string]*redis.Options)
+	var first *redis.Options
+	for _, c := range cfg.Addrs {
+		opts, err := redisOptions(c)
+		if err != nil {
+			rlog.Errorf("REDIS_CONF is not a valid redis URL - %s", err)
+			opts = &redis.Options{Addr: c}
+		}
+		cfg.apply(opts)
+		if first == nil {
+			first = opts
+		}
+		shards[opts.Addr] = opts
+	}
+	if len(shards) <= 1 {
+		if first == nil {
+			first = &redis.Options{}
+		}
+		return redis.NewClient(first)
+	}
+
+	ring := &redis.RingOptions{
+		Addrs: make(map[string]string, len(shards)),
+		// each shard keeps the credentials, DB and TLS from its own URL
+		NewClient: func(opt *redis.Options) *redis.Client {
+			return redis.NewClient(shards[opt.Addr])
+		},
 	}
+	for addr := range shards {
+		// named by address so the hash doesn't move if the list is reordered
+		ring.Addrs[addr] = addr
+	}
+	return redis.NewRing(ring)
+}
+
+// forEachShard runs fn against every Redis instance behind client, for
+// commands like SCAN that aren't routed by key.
+func forEachShard(ctx context.Context, client redis.UniversalClient, fn func(ctx context.Context, shard *redis.Client) error) error {
+	switch c := client.(type) {
+	case *redis.Ring:
+		return c.ForEachShard(ctx, fn)
+	case *redis.ClusterClient:
+		return c.ForEachMaster(ctx, fn)
+	case *redis.Client:
+		return fn(ctx, c)
+	}
+	return fmt.Errorf("unsupported redis client %T", client)
+}
+
+// redisOptions turns REDIS_CONF into client options.  A bare host:port is
+// just the address (DB 0, no password); a redis:// or rediss:// URL, as
+// handed out by managed Redis, also carries username, password, DB and TLS.
+func redisOptions(conf string) (*redis.Options, error) {
+	if strings.Contains(conf, "://") {
+		return redis.ParseURL(conf)
+	}
+	return &redis.Options{
+		Addr:     conf,
+		Password: "",
+		DB:       0,
+	}, nil
+}
+
+func (g *GeoIPData) checkRedisCache(redisClient redis.UniversalClient, ip string) bool {
+	return g.checkCache(context.Background(), NewRedisCache(redisClient), ip)
+}
+
+func (g *GeoIPData) checkCache(ctx context.Context, c Cache, ip string) bool {
+	cached, err := c.Get(ctx, cacheKey(ip))
 	if err != nil {
 		g.Located = false
 		return false
 	}
 
-	json.Unmarshal([]byte(jsonResult), g)
-	g.Located = true
+	g.fromCache(cached)
 	return true
 }
 
-func (g *GeoIPData) add2RedisCache(redisClient *redis.Client, minutes int) {
-	ttl := time.Duration(time.Minute * time.Duration(minutes))
-	ctx := context.Background()
-	jsonResult, _ := json.Marshal(g)
-	// we can call set with a `Key` and a `Value`.
-	err := redisClient.Set(ctx, g.IP, jsonResult, ttl).Err()
+func (g *GeoIPData) fromCache(cached GeoIPData) {
+	*g = cached
+	g.Located = true
+	if g.Provider == "" {
+		// cached before we recorded provenance
+		g.Provider = "cache"
+	}
+}
+
+// SetMinTTL sets a floor, in minutes, for cache writes.  Entries whose TTL
+// falls below the floor expire almost immediately, so they are not written
+// to Redis at all.  The default of 0 means no floor.
+func SetMinTTL(minutes int) {
+	minTTL = minutes
+}
+
+// SetUnknownCountry sets the CountryCode a lookup starts from, and keeps
+// if nothing locates the IP: "--" by default, or e.g. "" for empty.  The
+// country helpers treat it, "--" and "" alike as unknown.  Set it before
+// the first lookup; entries already cached with "--" still count as never
+// filled in.
+func SetUnknownCountry(cc string) {
+	unknownCC = cc
+}
+
+// SetTestIP makes GetGeoData answer data for exactly ip, without touching
+// the cache or the provider, so integration tests of downstream systems get
+// a stable, known result.  It is separate from the local LAN handling.
+// An empty ip turns it off.  Locators from NewGeoLocator take theirs from
+// WithTestIP instead.
+func SetTestIP(ip string, data GeoIPData) {
+	if data.IP == "" {
+		data.IP = ip
+	}
+	testIP = ip
+	testIPData = data
+}
+
+// SetProviderFields restricts which GeoIPData fields, by json name, a
+// provider answer is allowed to set, e.g. SetProviderFields("isp", "city").
+// Everything else keeps the value we had before the call.  With no names
+// every field is trusted, which is the default.
+func SetProviderFields(fields ...string) {
+	if len(fields) == 0 {
+		providerFields = nil
+		return
+	}
+	providerFields = make(map[string]bool, len(fields))
+	for _, f := range fields {
+		providerFields[f] = true
+	}
+}
+
+// SetProviderHeaders captures the named provider response headers, e.g.
+// "Retry-After" or "X-RateLimit-Remaining", into ProviderHeaders on each
+// result that went to the provider.  They describe that one response, so
+// they are not cached.  With no names nothing is captured (the default).
+func SetProviderHeaders(names ...string) {
+	providerHeaders = names
+}
+
+func (g *GeoIPData) captureHeaders(h http.Header) {
+	for _, name := range providerHeaders {
+		v := h.Get(name)
+		if v == "" {
+			continue
+		}
+		if g.ProviderHeaders == nil {
+			g.ProviderHeaders = make(map[string]string, len(providerHeaders))
+		}
+		g.ProviderHeaders[http.CanonicalHeaderKey(name)] = v
+	}
+}
+
+// copyProviderFields copies the fields allowed by SetProviderFields from a
+// provider answer onto g.
+func (g *GeoIPData) copyProviderFields(answer *GeoIPData) {
+	if providerFields == nil {
+		*g = *answer
+		return
+	}
+	dst := reflect.ValueOf(g).Elem()
+	src := reflect.ValueOf(answer).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		name, _, _ := strings.Cut(dst.Type().Field(i).Tag.Get("json"), ",")
+		if providerFields[name] {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+// SetProviderPool tunes the connection pool used for provider calls.  The
+// defaults (100 idle, 100 idle per host, 90s idle timeout) suit a single
+// provider host; call this before the first lookup.
+func SetProviderPool(maxIdleConns, maxIdleConnsPerHost int, idleConnTimeout time.Duration) {
+	providerTransport.MaxIdleConns = maxIdleConns
+	providerTransport.MaxIdleConnsPerHost = maxIdleConnsPerHost
+	providerTransport.IdleConnTimeout = idleConnTimeout
+}
+
+// SetProviderTimeout bounds each provider call, from dialing to reading
+// the body.  The default is 15s; 0 means no limit beyond the context.
+// Call it before the first lookup; it isn't safe to call while lookups
+// are running.
+func SetProviderTimeout(d time.Duration) {
+	httpClient.Timeout = d
+}
+
+// SetProviderProxy routes provider calls through proxy, e.g.
+// http.ProxyURL.  nil restores the default of HTTPS_PROXY and friends.
+// Call it before the first lookup; it isn't safe to call while lookups
+// are running.
+func SetProviderProxy(proxy func(*http.Request) (*url.URL, error)) {
+	if proxy == nil {
+		proxy = http.ProxyFromEnvironment
+	}
+	providerTransport.Proxy = proxy
+	// in case lookups already ran, don't reuse connections from before
+	providerTransport.CloseIdleConnections()
+}
+
+// SetProviderTLSConfig sets the TLS settings for provider calls, e.g.
+// custom root CAs or a client certificate.  Pins set with
+// SetProviderCertPins are kept unless c verifies certificates itself.
+// nil restores the defaults.  Call it before the first lookup; it isn't
+// safe to call while lookups are running.
+func SetProviderTLSConfig(c *tls.Config) {
+	var verify func([][]byte, [][]*x509.Certificate) error
+	if providerTransport.TLSClientConfig != nil {
+		verify = providerTransport.TLSClientConfig.VerifyPeerCertificate
+	}
+	if c == nil {
+		c = &tls.Config{}
+	} else {
+		c = c.Clone()
+	}
+	if c.VerifyPeerCertificate == nil {
+		c.VerifyPeerCertificate = verify
+	}
+	providerTransport.TLSClientConfig = c
+	// in case lookups already ran, don't reuse connections from before
+	providerTransport.CloseIdleConnections()
+}
+
+// SetTTL changes how long new cache entries live.  It is safe to call at
+// any time, e.g. from an admin endpoint; entries already cached keep
+// their TTL.  A d of 0 restores the default of 90 days.
+func SetTTL(d time.Duration) {
+	cacheTTL.Store(int64(d))
+}
+
+// currentTTL is the TTL for cache writes right now.
+func currentTTL() time.Duration {
+	if d := cacheTTL.Load(); d > 0 {
+		return time.Duration(d)
+	}
+	return time.Duration(ttl) * time.Minute
+}
+
+func (g *GeoIPData) add2RedisCache(ctx context.Context, redisClient redis.UniversalClient, ttl time.Duration) {
+	g.add2Cache(ctx, NewRedisCache(redisClient), ttl)
+}
+
+// add2Cache stores g in c for ttl.  ctx bounds the write, so a slow
+// cache can't hold a lookup past its deadline.
+func (g *GeoIPData) add2Cache(ctx context.Context, c Cache, ttl time.Duration) {
+	if ttl < time.Duration(minTTL)*time.Minute {
+		rlog.Debugf("Skipping Cache for %s - ttl %s below floor %d minutes", logIP(g.IP), ttl, minTTL)
+		g.EffectiveTTL = 0
+		return
+	}
+	g.EffectiveTTL = ttl
+	rlog.Debugf("Cache ttl for %s is %s", logIP(g.IP), ttl)
+	// the per-response fields aren't cached
+	entry := *g
+	entry.EffectiveTTL = 0
+	entry.ProviderHeaders = nil
+	entry.Degraded = false
+	err := c.Set(ctx, cacheKey(g.IP), entry, ttl)
 	// if there has been an error setting the value
-	// handle the error
-	if err != nil {
-		rlog.Errorf("Error adding to Redis Cache - %s", err)
+	// handle the error; a bypassed cache was already logged as failing
+	if errors.Is(err, ErrCacheUnavailable) {
+		rlog.Debugf("Skipping Cache for %s - cache bypassed", logIP(g.IP))
+	} else if err != nil {
+		rlog.Errorf("Error adding to Cache - %s", err)
 	}
 
 }
 
+// CheckOctets completes a three-octet IPv4 address, e.g. "8.8.8", with o
+// as the last octet.  Anything else, including IPv6, is left alone.
 func (g *GeoIPData) CheckOctets(o string) {
 	octets := strings.Split(g.IP, ".")
 	if len(octets) == 3 {
@@ -114,139 +431,454 @@ func (g *GeoIPData) CheckOctets(o string) {
 
 // GetGeoData initializes a search for the geoLocation of an IP.  Module entry point
 func GetGeoData(ip string) GeoIPData {
+	geo, _ := std().GetGeoData(context.Background(), ip)
+	return geo
+}
+
+// GetGeoDataContext is GetGeoData bounded by ctx, also saying why there's
+// no answer: ErrInvalidIP, ErrNonRoutable, ErrUpstreamUnavailable,
+// ErrRateLimited or ErrNoCache, to test for with errors.Is.  geo is filled
+// in as far as it could be either way.
+func GetGeoDataContext(ctx context.Context, ip string) (GeoIPData, error) {
+	return std().GetGeoData(ctx, ip)
+}
+
+// LocalTimeAt looks up ip and returns the current time in its timezone,
+// see GeoLocator.LocalTimeAt.
+func LocalTimeAt(ctx context.Context, ip string) (time.Time, error) {
+	return std().LocalTimeAt(ctx, ip)
+}
+
+// LocalTimeAt looks up ip and returns the current time in its timezone,
+// e.g. to hold back notifications when it's the middle of the night there.
+// A failed lookup's error is returned as is, to test for with errors.Is.
+func (l *GeoLocator) LocalTimeAt(ctx context.Context, ip string) (time.Time, error) {
+	geo, err := l.GetGeoData(ctx, ip)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// LoadLocation("") is UTC, which would be a lie here
+	if geo.TimezoneName == "" {
+		return time.Time{}, fmt.Errorf("LocalTimeAt: no timezone known for IP: %s", geo.IP)
+	}
+	loc, err := time.LoadLocation(geo.TimezoneName)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("LocalTimeAt: unknown timezone %q for IP: %s - %w", geo.TimezoneName, geo.IP, err)
+	}
+	return time.Now().In(loc), nil
+}
+
+// ErrCacheMiss is returned by GetCachedOrMiss when the IP isn't cached.
+var ErrCacheMiss = errors.New("me_geolocate: cache miss")
+
+// GetCachedOrMiss answers from the cache only, for setups where a separate
+// worker owns all provider fetches, see GeoLocator.GetCachedOrMiss.
+func GetCachedOrMiss(ctx context.Context, ip string) (GeoIPData, error) {
+	return std().GetCachedOrMiss(ctx, ip)
+}
+
+// GetCachedOrMiss answers from the locator's cache only, for setups where
+// a separate worker owns all provider fetches.  Local and non-routable IPs
+// are answered as usual without an error; anything else not in the cache
+// returns ErrCacheMiss and the provider is never called.  Input that isn't
+// an IP is ErrInvalidIP, and with no cache it is ErrNoCache.
+func (l *GeoLocator) GetCachedOrMiss(ctx context.Context, ip string) (GeoIPData, error) {
+	if geo, ok := matchOverride(l.overrides, ip); ok {
+		return geo, nil
+	}
+	geo := newGeoIPData(ip)
+	if _, ok := parseAddr(geo.IP); !ok {
+		geo.Provider = "invalid"
+		geo.Error = "Invalid IP address"
+		return geo, fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+	}
+
+	if geo.isLocalIn(l.localNets) {
+		return geo, nil
+	}
+	if geo.isRoutable(); !geo.Routable {
+		return geo, nil
+	}
+
+	if l.cache == nil {
+		return geo, ErrNoCache
+	}
+	cached, err := l.cache.Get(ctx, cacheKey(geo.IP))
+	if err != nil {
+		l.cacheResult(false)
+		if ctx.Err() != nil {
+			return geo, ctx.Err()
+		}
+		return geo, ErrCacheMiss
+	}
+	geo.fromCache(cached)
+	geo.CacheHit = true
+	if (placeholderCountry(geo.CountryCode) && geo.Provider != providerNegative) || l.tooCoarse(geo) {
+		l.cacheResult(false)
+		return geo, ErrCacheMiss
+	}
+	l.cacheResult(true)
+	return geo, nil
+}
+
+// ErrInvalidIP is returned for input that isn't an IP address.
+var ErrInvalidIP = errors.New("me_geolocate: invalid IP address")
+
+// ErrNonRoutable is returned for private and reserved addresses, which are
+// answered without asking the provider.  Local networks aren't an error.
+var ErrNonRoutable = errors.New("me_geolocate: non-routable IP address")
+
+// ErrUpstreamUnavailable is returned when no provider located the IP,
+// because it couldn't be reached or didn't know.  It wraps the last
+// provider's error.  A failure cached with WithNegativeTTL returns it too.
+var ErrUpstreamUnavailable = errors.New("me_geolocate: upstream unavailable")
+
+// IsGeolocatable is a cheap pre-filter: it says whether ip is worth a lookup
+// at all, see GeoLocator.IsGeolocatable.
+func IsGeolocatable(ctx context.Context, ip string) (bool, error) {
+	return std().IsGeolocatable(ctx, ip)
+}
+
+// IsGeolocatable says whether ip is worth a lookup at all.  Invalid, local
+// (see WithLocalNetworks), non-routable and reserved addresses are false;
+// input GetGeoData would turn away is ErrInvalidIP.  Nothing is fetched
+// and the cache isn't read, so ctx is only checked.
+func (l *GeoLocator) IsGeolocatable(ctx context.Context, ip string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	geo := newGeoIPData(ip)
+	if _, ok := parseAddr(geo.IP); !ok {
+		return false, fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+	}
+	if geo.isLocalIn(l.localNets) || !geo.isRoutable() {
+		return false, nil
+	}
+	return true, nil
+}
+
+// newGeoIPData returns the placeholder result every lookup starts from.
+func newGeoIPData(ip string) GeoIPData {
 	geo := GeoIPData{
 		IP:          ip,
 		ISP:         "-----",
-		CountryCode: "--",
+		CountryCode: unknownCC,
 		City:        "-----",
 		CountryName: "-----",
 		CacheHit:    false,
 	}
 
 	geo.CheckOctets("112")
+	return geo
+}
+
+// unknownCountry reports whether cc is a placeholder rather than a real
+// country code: the one every lookup starts from, see SetUnknownCountry,
+// or empty from a provider that didn't know.  Anything deriving from the
+// country should ask this rather than compare against one of them.
+func unknownCountry(cc string) bool {
+	cc = strings.TrimSpace(cc)
+	return cc == "" || cc == "--" || cc == unknownCC
+}
+
+// placeholderCountry reports whether cc is still the placeholder a lookup
+// starts from, i.e. whether a cached entry was never filled in by the
+// provider.  Unlike unknownCountry an empty answer counts as filled in,
+// unless empty is the placeholder.
+func placeholderCountry(cc string) bool {
+	return cc == "--" || cc == unknownCC
+}
 
-	if redis_addr == "" {
-		rlog.Error("Warning: REDIS_CONF not set")
-		rlog.Printf("%+v\n", geo)
-		return geo
+// GetGeoDataGroupedByCountry looks up ips with GetGeoDataBatch and
+// buckets the results by CountryCode.  Unknown countries share the "--"
+// bucket.  Per-IP errors are kept on each entry's Error field; the error is
+// the batch's, and the groups hold whatever was answered.
+func GetGeoDataGroupedByCountry(ctx context.Context, ips []string) (map[string][]GeoIPData, error) {
+	results, err := std().GetGeoDataBatch(ctx, ips)
+	return groupGeoData(results, func(geo GeoIPData) string { return geo.CountryCode }), err
+}
+
+// GetGeoDataGroupedByASN looks up ips with GetGeoDataBatch and buckets the
+// results by Asn, e.g. "AS15169", to group traffic by network operator.
+// IPs with no known ASN share the "--" bucket.  The error is the batch's;
+// the groups hold whatever was answered.
+func GetGeoDataGroupedByASN(ctx context.Context, ips []string) (map[string][]GeoIPData, error) {
+	results, err := std().GetGeoDataBatch(ctx, ips)
+	return groupGeoData(results, func(geo GeoIPData) string { return geo.Asn }), err
+}
+
+// groupGeoData buckets geos by key, with "--" for an empty key.
+func groupGeoData(geos []GeoIPData, key func(GeoIPData) string) map[string][]GeoIPData {
+	groups := make(map[string][]GeoIPData)
+	for _, geo := range geos {
+		k := strings.TrimSpace(key(geo))
+		if k == "" {
+			k = "--"
+		}
+		groups[k] = append(groups[k], geo)
 	}
+	return groups
+}
 
-	// using Redis?  check there first
-	geo.CacheHit = geo.checkRedisCache(redisClient, ip)
-	if geo.CacheHit && geo.CountryCode != "--" {
-		rlog.Printf("%+v\n", geo)
-		return geo
+// GetGeoDataAs looks up ip and hands the result to conv, for callers that
+// always map GeoIPData onto their own type.  The error is
+// GetGeoDataContext's; conv still sees the placeholder or partial answer.
+func GetGeoDataAs[T any](ctx context.Context, ip string, conv func(GeoIPData) T) (T, error) {
+	return LookupAs(ctx, std(), ip, conv)
+}
+
+// LookupAs is GetGeoDataAs using l.
+func LookupAs[T any](ctx context.Context, l Locator, ip string, conv func(GeoIPData) T) (T, error) {
+	geo, err := l.GetGeoData(ctx, ip)
+	return conv(geo), err
+}
+
+// LocalNetRule answers lookups in a LAN range ourselves instead of
+// calling the provider, see SetLocalNetworks.  Country is the ISO code.
+type LocalNetRule struct {
+	CIDR          string
+	ISP           string
+	City          string
+	Country       string
+	CountryName   string
+	Region        string
+	PostalCode    string
+	ContinentCode string
+	ContinentName string
+	Latitude      float64
+	Longitude     float64
+}
+
+// the rule we had before local networks were configurable
+var defaultLocalNetworks = []LocalNetRule{{
+	CIDR:          "192.168.106.0/24",
+	ISP:           "LaughingJ",
+	City:          "Lewisville",
+	Country:       "US",
+	CountryName:   "United States",
+	Region:        "Texas",
+	PostalCode:    "75067",
+	ContinentCode: "NA",
+	ContinentName: "North America",
+	Latitude:      33.000000,
+	Longitude:     -97.000000,
+}}
+
+type localNetwork struct {
+	prefix netip.Prefix
+	rule   LocalNetRule
+}
+
+// our local LANs, which we "route" ourselves
+var localNetworks, _ = parseLocalNetworks(defaultLocalNetworks)
+
+// SetLocalNetworks replaces the LAN ranges answered locally, with Provider
+// "local", for the package-level functions.  The first matching rule wins.
+// An empty list turns local answers off.  The default is 192.168.106.0/24
+// as LaughingJ in Lewisville, for backward compatibility.  Call it before
+// the first lookup.
+func SetLocalNetworks(rules []LocalNetRule) error {
+	nets, err := parseLocalNetworks(rules)
+	if err != nil {
+		return err
 	}
+	localNetworks = nets
+	return nil
+}
 
-	// if we get here, it's not found in the cache, or hasn't been updated by the geo api
-	// is it a routable IP?  if not, no need to call the service.
-	// update GeoIPData, and add to cache
-	if geo.isLocal() || !geo.isRoutable() {
-		geo.add2RedisCache(redisClient, ttl)
-		rlog.Printf("%+v\n", geo)
-		return geo
+func parseLocalNetworks(rules []LocalNetRule) ([]localNetwork, error) {
+	nets := make([]localNetwork, 0, len(rules))
+	for _, r := range rules {
+		prefix, err := netip.ParsePrefix(r.CIDR)
+		if err != nil {
+			return nil, fmt.Errorf("local network %q: %w", r.CIDR, err)
+		}
+		nets = append(nets, localNetwork{prefix: prefix.Masked(), rule: r})
 	}
+	return nets, nil
+}
 
-	//ip should be routable, so call the location service
-	geo.obtainGeoDat()
+// private, loopback, link-local and carrier NAT ranges
+var nonRoutableNets = []netip.Prefix{
+	netip.MustParsePrefix("10.0.0.0/8"),     // RFC 1918
+	netip.MustParsePrefix("172.16.0.0/12"),  // RFC 1918
+	netip.MustParsePrefix("192.168.0.0/16"), // RFC 1918
+	netip.MustParsePrefix("127.0.0.0/8"),    // loopback
+	netip.MustParsePrefix("169.254.0.0/16"), // link-local
+	netip.MustParsePrefix("100.64.0.0/10"),  // carrier-grade NAT
+	netip.MustParsePrefix("::1/128"),        // loopback
+	netip.MustParsePrefix("fe80::/10"),      // link-local
+	netip.MustParsePrefix("fc00::/7"),       // unique local (ULA)
+}
 
-	geo.add2RedisCache(redisClient, ttl)
-	rlog.Printf("%+v\n", geo)
-	return geo
+// special-use ranges that can never be geolocated
+var reservedNets = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),       // "this network"
+	netip.MustParsePrefix("192.0.0.0/24"),    // IETF protocol assignments
+	netip.MustParsePrefix("192.0.2.0/24"),    // documentation (TEST-NET-1)
+	netip.MustParsePrefix("198.51.100.0/24"), // documentation (TEST-NET-2)
+	netip.MustParsePrefix("203.0.113.0/24"),  // documentation (TEST-NET-3)
+	netip.MustParsePrefix("198.18.0.0/15"),   // benchmarking
+	netip.MustParsePrefix("224.0.0.0/4"),     // multicast
+	netip.MustParsePrefix("240.0.0.0/4"),     // reserved, and broadcast
+	netip.MustParsePrefix("::/128"),          // unspecified
+	netip.MustParsePrefix("ff00::/8"),        // multicast
+	netip.MustParsePrefix("2001:db8::/32"),   // documentation
+	netip.MustParsePrefix("3fff::/20"),       // documentation
+}
+
+// parseAddr parses ip for range checks: IPv4-mapped IPv6 is treated as the
+// IPv4 address and any zone is dropped.
+func parseAddr(ip string) (netip.Addr, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap().WithZone(""), true
+}
+
+func inNets(nets []netip.Prefix, addr netip.Addr) bool {
+	for _, n := range nets {
+		if n.Contains(addr) {
+			return true
+		}
+	}
+	return false
 }
 
 func (g *GeoIPData) isLocal() bool {
+	return g.isLocalIn(localNetworks)
+}
+
+// isLocalIn answers g from the first of nets holding g.IP, if any.
+func (g *GeoIPData) isLocalIn(nets []localNetwork) bool {
 	// let's "route" our local LAN
-	if strings.HasPrefix(g.IP, "192.168.106.") {
+	addr, ok := parseAddr(g.IP)
+	if !ok {
+		return false
+	}
+	for _, n := range nets {
+		if !n.prefix.Contains(addr) {
+			continue
+		}
 		g.Located = true
 		g.Routable = false
-		g.ISP = "LaughingJ"
-		g.CountryCode = "US"
-		g.City = "Lewisville"
-		g.CountryName = "United States"
-		g.Latitude = 33.000000
-		g.Longitude = -97.000000
-		g.PostalCode = "75067"
-		g.ContinentCode = "NA"
-		g.ContinentName = "North America"
-		g.Region = "Texas"
-		rlog.Infof("%s is LaughingJ", g.IP)
+		g.ISP = n.rule.ISP
+		g.CountryCode = n.rule.Country
+		g.City = n.rule.City
+		g.CountryName = n.rule.CountryName
+		g.Latitude = n.rule.Latitude
+		g.Longitude = n.rule.Longitude
+		g.PostalCode = n.rule.PostalCode
+		g.ContinentCode = n.rule.ContinentCode
+		g.ContinentName = n.rule.ContinentName
+		g.Region = n.rule.Region
+		g.Provider = "local"
+		rlog.Infof("%s is %s", logIP(g.IP), n.rule.ISP)
 		return true
 	}
 	return false
 }
 
+// isRoutable checks g.IP against the non-routable and reserved ranges,
+// IPv4 and IPv6.  Anything that doesn't parse is left to the provider.
 func (g *GeoIPData) isRoutable() bool {
-	// 192.168.0.0 to 192.168.255.255
-	// 10.0.0.0 to 10.255.255.255
-	// 172.16.0.0 to 172.31.255.255
-	nonRoutable := []string{
-		"192.168.",
-		"10.",
-		"172.16.",
-		"172.17.",
-		"172.18.",
-		"172.19.",
-		"172.20.",
-		"172.21.",
-		"172.22.",
-		"172.23.",
-		"172.24.",
-		"172.25.",
-		"172.26.",
-		"172.27.",
-		"172.28.",
-		"172.29.",
-		"172.30.",
-		"172.31.",
-	}
-
 	g.Routable = true
 
-	for _, v := range nonRoutable {
-		if strings.HasPrefix(g.IP, v) {
+	if addr, ok := parseAddr(g.IP); ok {
+		switch {
+		case inNets(nonRoutableNets, addr):
+			g.Routable = false
+			g.Provider = "non-routable"
+		case inNets(reservedNets, addr):
 			g.Routable = false
-			g.Success = false
-			g.Error = fmt.Sprintf("Invalid public IPv4 or IPv6 address %s", g.IP)
+			g.Provider = "reserved"
 		}
 	}
-	return true
+
+	if !g.Routable {
+		// same wording the provider uses, so callers see one message
+		g.Success = false
+		g.Error = "Invalid public IPv4 or IPv6 address"
+	}
+	return g.Routable
 }
 
-func (g *GeoIPData) obtainGeoDat() string {
+// obtainGeoDat asks the provider about g.IP.  A provider that answers
+// 200 OK but with success:false or an error message has not located the
+// IP, so that comes back as an error as well.
+func (g *GeoIPData) obtainGeoDat(ctx context.Context) error {
+	return g.lookupWith(ctx, &GeoIPLookupProvider{})
+}
 
-	url := fmt.Sprintf("https://json.geoiplookup.io/%s", g.IP)
+// checkCoordinates zeroes a latitude/longitude pair that falls outside the
+// valid ranges, so a buggy provider answer can't poison maps or distance math.
+func (g *GeoIPData) checkCoordinates() bool {
+	if validCoordinates(g.Latitude, g.Longitude) {
+		return true
+	}
+	rlog.Warnf("Invalid coordinates for IP: %s - lat %f lon %f", logIP(g.IP), g.Latitude, g.Longitude)
+	g.Latitude = 0
+	g.Longitude = 0
+	return false
+}
 
-	req, _ := http.NewRequest("GET", url, nil)
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Accept-Encoding", "gzip")
+// validCoordinates reports whether lat and lon are in range.
+func validCoordinates(lat, lon float64) bool {
+	return lat >= -90 && lat <= 90 && lon >= -180 && lon <= 180
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// MarshalSubset emits only the named fields of geo as a JSON object, in the
+// order asked for, e.g. MarshalSubset("country_code", "city").  Names are
+// the json names; an unknown name is an error.
+func (geo GeoIPData) MarshalSubset(fields ...string) ([]byte, error) {
+	byt, err := json.Marshal(geo)
 	if err != nil {
-		defer resp.Body.Close()
+		return nil, err
 	}
-
-	if resp.Status != "200 OK" {
-		g.Error = fmt.Sprintf("GetGeoData received invalid response for IP: %s - %s", g.IP, resp.Status)
+	all := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(byt, &all); err != nil {
+		return nil, err
 	}
 
-	var reader io.ReadCloser
-	switch resp.Header.Get("Content-Encoding") {
-	case "gzip":
-		reader, _ = gzip.NewReader(resp.Body)
-	default:
-		reader = resp.Body
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range fields {
+		val, ok := all[f]
+		if !ok {
+			return nil, fmt.Errorf("MarshalSubset: unknown field %q", f)
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(f)
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(val)
 	}
-	defer reader.Close()
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
 
-	byt, err := io.ReadAll(reader)
-	if err != nil {
-		g.Error = fmt.Sprintf("Reading our reader failed - %s", err)
+// AccessLogFields formats the geo columns to append to a common log format
+// line: the client IP, then the quoted country code and city.  Unknown
+// values are written as "-" the way CLF does.
+func (geo GeoIPData) AccessLogFields() string {
+	ip := geo.IP
+	if ip == "" {
+		ip = "-"
 	}
-	json.Unmarshal([]byte(byt), g)
-	g.Located = true
+	cc := geo.CountryCode
+	if unknownCountry(cc) {
+		cc = ""
+	}
+	return ip + " " + clfQuote(cc) + " " + clfQuote(geo.City)
+}
 
-	rlog.Debug(fmt.Sprintf("parsed Geo answer for IP:%s --> %v ", g.IP, g))
-	jsonResult, _ := json.Marshal(g)
-	return string(jsonResult)
+func clfQuote(s string) string {
+	switch strings.TrimSpace(s) {
+	case "", "-----":
+		return `"-"`
+	}
+	return strconv.Quote(s)
 }
@@ -0,0 +1,108 @@
+package me_geolocate
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryCache is an in-process LRU Cache, for CLI tools and tests that
+// have no Redis server.  Once full, the least recently used entry is
+// evicted to make room.
+type MemoryCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type memEntry struct {
+	key     string
+	geo     GeoIPData
+	expires time.Time // zero = never
+}
+
+// NewMemoryCache returns an empty MemoryCache holding up to size entries.
+// A size below 1 holds one.
+func NewMemoryCache(size int) *MemoryCache {
+	if size < 1 {
+		size = 1
+	}
+	return &MemoryCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (GeoIPData, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return GeoIPData{}, ErrCacheMiss
+	}
+	e := el.Value.(*memEntry)
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.remove(el)
+		return GeoIPData{}, ErrCacheMiss
+	}
+	c.order.MoveToFront(el)
+	return e.geo, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error {
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value = &memEntry{key: key, geo: geo, expires: expires}
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.entries[key] = c.order.PushFront(&memEntry{key: key, geo: geo, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *MemoryCache) Delete(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+// Len is the number of entries held, including expired ones not yet
+// noticed.
+func (c *MemoryCache) ttl(ctx context.Context, key string) (time.Duration, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok || el.Value.(*memEntry).expires.IsZero() {
+		return 0, nil
+	}
+	return max(time.Until(el.Value.(*memEntry).expires), 0), nil
+}
+
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *MemoryCache) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.entries, el.Value.(*memEntry).key)
+}
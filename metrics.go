@@ -0,0 +1,115 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// WithMetricsRegistry registers the locator's Prometheus metrics with reg:
+//
+//	geolocate_cache_requests_total{result="hit|miss"}
+//	geolocate_upstream_request_duration_seconds{provider}
+//	geolocate_upstream_errors_total{provider,code}
+//	geolocate_local_answers_total{kind="local|non-routable|reserved|override"}
+//
+// code is the provider's HTTP status, or "none" if no response came back
+// (a network error, or a provider that isn't HTTP).  Locators sharing a
+// registry share the metrics.
+func WithMetricsRegistry(reg prometheus.Registerer) Option {
+	return func(l *GeoLocator) { l.metrics = newMetrics(reg) }
+}
+
+type metrics struct {
+	cache    *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	errors   *prometheus.CounterVec
+	local    *prometheus.CounterVec
+}
+
+func newMetrics(reg prometheus.Registerer) *metrics {
+	return &metrics{
+		cache: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "geolocate_cache_requests_total",
+			Help: "Cache lookups by result.",
+		}, []string{"result"})),
+		duration: register(reg, prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "geolocate_upstream_request_duration_seconds",
+			Help:    "Time taken by each provider call.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"provider"})),
+		errors: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "geolocate_upstream_errors_total",
+			Help: "Failed provider calls by provider and HTTP status.",
+		}, []string{"provider", "code"})),
+		local: register(reg, prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "geolocate_local_answers_total",
+			Help: "Lookups answered without the provider, by kind.",
+		}, []string{"kind"})),
+	}
+}
+
+// register registers c with reg, or returns the collector already
+// registered under the same name.
+func register[C prometheus.Collector](reg prometheus.Registerer, c C) C {
+	if err := reg.Register(c); err != nil {
+		var are prometheus.AlreadyRegisteredError
+		if errors.As(err, &are) {
+			if existing, ok := are.ExistingCollector.(C); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return c
+}
+
+func (m *metrics) cacheResult(hit bool) {
+	if m == nil {
+		return
+	}
+	if hit {
+		m.cache.WithLabelValues("hit").Inc()
+	} else {
+		m.cache.WithLabelValues("miss").Inc()
+	}
+}
+
+func (m *metrics) answered(kind string) {
+	if m == nil {
+		return
+	}
+	m.local.WithLabelValues(kind).Inc()
+}
+
+func (m *metrics) upstream(provider string, took time.Duration, status int, err error) {
+	if m == nil {
+		return
+	}
+	m.duration.WithLabelValues(provider).Observe(took.Seconds())
+	if err == nil {
+		return
+	}
+	code := "none"
+	if status != 0 {
+		code = strconv.Itoa(status)
+	}
+	m.errors.WithLabelValues(provider, code).Inc()
+}
+
+type statusKey struct{}
+
+// withStatus has providerGet record the HTTP status of its response in
+// *status, for labelling metrics.
+func withStatus(ctx context.Context, status *int) context.Context {
+	return context.WithValue(ctx, statusKey{}, status)
+}
+
+func recordStatus(ctx context.Context, code int) {
+	if status, ok := ctx.Value(statusKey{}).(*int); ok {
+		*status = code
+	}
+}
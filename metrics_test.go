@@ -0,0 +1,59 @@
+package me_geolocate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestWithMetricsRegistry(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/1.1.1.1") {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	}))
+	defer srv.Close()
+
+	reg := prometheus.NewRegistry()
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"), WithMetricsRegistry(reg))
+	l.GetGeoData(context.Background(), "8.8.8.8")
+	l.GetGeoData(context.Background(), "8.8.8.8")
+	l.GetGeoData(context.Background(), "1.1.1.1")
+	l.GetGeoData(context.Background(), "10.0.0.1")
+	l.GetGeoData(context.Background(), "192.168.106.7")
+
+	m := l.metrics
+	checks := []struct {
+		name string
+		c    prometheus.Collector
+		want float64
+	}{
+		{"hits", m.cache.WithLabelValues("hit"), 1},
+		{"misses", m.cache.WithLabelValues("miss"), 4},
+		{"429s", m.errors.WithLabelValues(providerName, "429"), 1},
+		{"non-routable", m.local.WithLabelValues("non-routable"), 1},
+		{"local", m.local.WithLabelValues("local"), 1},
+	}
+	for _, c := range checks {
+		if got := testutil.ToFloat64(c.c); got != c.want {
+			t.Errorf("%s want: %v\ngot: %v\n", c.name, c.want, got)
+		}
+	}
+	if n := testutil.CollectAndCount(m.duration); n != 1 {
+		t.Errorf("want: 1 duration series\ngot: %d\n", n)
+	}
+
+	// a second locator on the same registry shares the metrics
+	l2 := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithMetricsRegistry(reg))
+	if l2.metrics.cache != m.cache {
+		t.Errorf("want: shared collectors\ngot: new ones\n")
+	}
+}
@@ -0,0 +1,122 @@
+package me_geolocate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+)
+
+var trustedMu sync.RWMutex
+var trustedProxies []netip.Prefix // see SetTrustedProxies
+
+type geoKey struct{}
+
+// SetTrustedProxies lists the proxies, as CIDRs or single IPs, whose
+// X-Forwarded-For and X-Real-IP headers GeoMiddleware believes.  A request
+// from one of them is attributed to the last X-Forwarded-For hop that isn't
+// itself trusted, or failing that to X-Real-IP.  With none set, the default,
+// the headers are ignored and the connecting address is used, since anyone
+// can send them.
+func SetTrustedProxies(proxies ...string) error {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, p := range proxies {
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(p)
+			if aerr != nil {
+				return fmt.Errorf("%w: %q", ErrInvalidIP, p)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	trustedMu.Lock()
+	defer trustedMu.Unlock()
+	trustedProxies = prefixes
+	return nil
+}
+
+func trustedProxy(ip string) bool {
+	addr, ok := parseAddr(ip)
+	if !ok {
+		return false
+	}
+	trustedMu.RLock()
+	defer trustedMu.RUnlock()
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP is the address r came from, following SetTrustedProxies.  It is
+// false if none can be made out.
+func ClientIP(r *http.Request) (string, bool) {
+	ip, ok := hopIP(r.RemoteAddr)
+	if !ok || !trustedProxy(ip) {
+		return ip, ok
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, ok := hopIP(strings.TrimSpace(hops[i]))
+		if !ok {
+			break
+		}
+		ip = hop
+		if !trustedProxy(hop) {
+			return ip, true
+		}
+	}
+	if len(hops) == 0 {
+		if real, ok := hopIP(strings.TrimSpace(r.Header.Get("X-Real-IP"))); ok {
+			return real, true
+		}
+	}
+	return ip, true
+}
+
+// GeoMiddleware looks up each request's client IP, see ClientIP, before
+// passing it on to next.  Handlers get the answer with FromContext.
+func GeoMiddleware(next http.Handler) http.Handler {
+	return geoMiddleware(func() Locator { return std() }, next)
+}
+
+// Middleware is GeoMiddleware using this locator.
+func (l *GeoLocator) Middleware(next http.Handler) http.Handler {
+	return LocatorMiddleware(l, next)
+}
+
+// LocatorMiddleware is GeoMiddleware using l.
+func LocatorMiddleware(l Locator, next http.Handler) http.Handler {
+	return geoMiddleware(func() Locator { return l }, next)
+}
+
+func geoMiddleware(locator func() Locator, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip, ok := ClientIP(r); ok {
+			geo, _ := locator().GetGeoData(r.Context(), ip)
+			r = r.WithContext(NewContext(r.Context(), geo))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// NewContext returns a copy of ctx carrying geo, for FromContext.
+func NewContext(ctx context.Context, geo GeoIPData) context.Context {
+	return context.WithValue(ctx, geoKey{}, geo)
+}
+
+// FromContext returns the lookup GeoMiddleware stored for the request.
+// It is false if there is none, e.g. the client IP couldn't be made out.
+func FromContext(ctx context.Context) (GeoIPData, bool) {
+	geo, ok := ctx.Value(geoKey{}).(GeoIPData)
+	return geo, ok
+}
@@ -0,0 +1,69 @@
+package me_geolocate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	if err := SetTrustedProxies("10.0.0.0/8", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetTrustedProxies() })
+
+	tests := []struct {
+		remote, xff, realIP string
+		want                string
+	}{
+		{"8.8.8.8:1234", "", "", "8.8.8.8"},
+		{"8.8.8.8:1234", "1.1.1.1", "", "8.8.8.8"},                     // untrusted peer, headers ignored
+		{"10.1.2.3:1234", "1.1.1.1", "", "1.1.1.1"},                    // trusted peer
+		{"10.1.2.3:1234", "9.9.9.9, 1.1.1.1, 10.0.0.5", "", "1.1.1.1"}, // skip trusted hops, not spoofed ones
+		{"192.0.2.1:1234", "", "1.1.1.1", "1.1.1.1"},
+		{"10.1.2.3:1234", "10.0.0.9", "", "10.0.0.9"}, // all trusted, leftmost
+		{"[2001:db8::1]:443", "", "", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = tt.remote
+		if tt.xff != "" {
+			r.Header.Set("X-Forwarded-For", tt.xff)
+		}
+		if tt.realIP != "" {
+			r.Header.Set("X-Real-IP", tt.realIP)
+		}
+		if got, ok := ClientIP(r); !ok || got != tt.want {
+			t.Errorf("%s %q want: %s\ngot: %s %v\n", tt.remote, tt.xff, tt.want, got, ok)
+		}
+	}
+
+	if err := SetTrustedProxies("nope"); err == nil {
+		t.Errorf("want: an error\ngot: nil\n")
+	}
+}
+
+func TestGeoMiddleware(t *testing.T) {
+	url := providerServer(t, `{"ip":"8.8.8.8","country":"US","org":"AS15169 Google LLC"}`, nil)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithProvider(&IPInfoProvider{URL: url + "/%s/json"}))
+	defer l.Close()
+
+	var got GeoIPData
+	var ok bool
+	h := l.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok = FromContext(r.Context())
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.RemoteAddr = "8.8.8.8:1234"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if !ok || got.IP != "8.8.8.8" || got.CountryCode != "US" {
+		t.Errorf("want: 8.8.8.8 US\ngot: %v %+v\n", ok, got)
+	}
+
+	r.RemoteAddr = "@"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if ok {
+		t.Errorf("want: no geo data\ngot: %+v\n", got)
+	}
+}
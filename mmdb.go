@@ -0,0 +1,255 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/romana/rlog"
+)
+
+// MMDBProvider answers from local MaxMind databases (GeoLite2-City and
+// optionally GeoLite2-ASN), so lookups need no network at all.  Build it
+// with NewMMDBProvider and Close it when done.
+type MMDBProvider struct {
+	cityPath, asnPath string
+
+	mu       sync.RWMutex
+	city     *maxminddb.Reader
+	asn      *maxminddb.Reader // nil = no ASN database
+	cityMod  time.Time
+	asnMod   time.Time
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+type mmdbNames struct {
+	En string `maxminddb:"en"`
+}
+
+type mmdbCity struct {
+	City struct {
+		Names mmdbNames `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Continent struct {
+		Code  string    `maxminddb:"code"`
+		Names mmdbNames `maxminddb:"names"`
+	} `maxminddb:"continent"`
+	Country struct {
+		ISOCode string    `maxminddb:"iso_code"`
+		Names   mmdbNames `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Location struct {
+		Latitude  float64 `maxminddb:"latitude"`
+		Longitude float64 `maxminddb:"longitude"`
+		TimeZone  string  `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+	Subdivisions []struct {
+		Names mmdbNames `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+}
+
+type mmdbASN struct {
+	Number int    `maxminddb:"autonomous_system_number"`
+	Org    string `maxminddb:"autonomous_system_organization"`
+}
+
+// NewMMDBProvider opens the City database at cityPath and, unless asnPath
+// is empty, the ASN database at asnPath.  If reload is positive the files
+// are checked that often and reopened when they change on disk, so a
+// database update doesn't need a restart.  An ASN-only provider (empty
+// cityPath) can't locate IPs; it is for WithASNDatabase.
+func NewMMDBProvider(cityPath, asnPath string, reload time.Duration) (*MMDBProvider, error) {
+	p := &MMDBProvider{cityPath: cityPath, asnPath: asnPath, stop: make(chan struct{})}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	if reload > 0 {
+		go p.watch(reload)
+	}
+	return p, nil
+}
+
+func (p *MMDBProvider) Name() string { return "mmdb" }
+
+func (p *MMDBProvider) Lookup(ctx context.Context, g *GeoIPData) error {
+	ip := net.ParseIP(g.IP)
+	if ip == nil {
+		g.Error = "Invalid public IPv4 or IPv6 address"
+		return fmt.Errorf("GetGeoData provider did not locate IP: %s - %s", g.IP, g.Error)
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.city == nil {
+		g.Error = "GetGeoData mmdb provider has no City database open"
+		return errors.New(g.Error)
+	}
+
+	var rec mmdbCity
+	_, found, err := p.city.LookupNetwork(ip, &rec)
+	if err != nil {
+		g.Error = fmt.Sprintf("GetGeoData could not read mmdb for IP: %s - %s", g.IP, err)
+		return errors.New(g.Error)
+	}
+	if !found {
+		g.Error = "IP not found in database"
+		return fmt.Errorf("GetGeoData provider did not locate IP: %s - %s", g.IP, g.Error)
+	}
+
+	g.Success = true
+	g.City = rec.City.Names.En
+	g.ContinentCode = rec.Continent.Code
+	g.ContinentName = rec.Continent.Names.En
+	g.CountryCode = rec.Country.ISOCode
+	g.CountryName = rec.Country.Names.En
+	g.Latitude = rec.Location.Latitude
+	g.Longitude = rec.Location.Longitude
+	g.TimezoneName = rec.Location.TimeZone
+	g.PostalCode = rec.Postal.Code
+	if len(rec.Subdivisions) > 0 {
+		g.Region = rec.Subdivisions[0].Names.En
+	}
+
+	if p.lookupASN(ip, g) {
+		g.ISP = g.AsnOrg
+		g.Org = g.AsnOrg
+	}
+	return nil
+}
+
+// lookupASN fills in g's ASN fields from the ASN database, if there is one
+// and it knows ip.  The caller holds p.mu.
+func (p *MMDBProvider) lookupASN(ip net.IP, g *GeoIPData) bool {
+	if p.asn == nil {
+		return false
+	}
+	var as mmdbASN
+	if err := p.asn.Lookup(ip, &as); err != nil || as.Number == 0 {
+		return false
+	}
+	g.AsnNumber = as.Number
+	g.Asn = fmt.Sprintf("AS%d", as.Number)
+	g.AsnOrg = as.Org
+	return true
+}
+
+// enrichASN fills in g's ASN fields if the provider that answered left
+// them out, see WithASNDatabase.
+func (p *MMDBProvider) enrichASN(g *GeoIPData) {
+	ip := net.ParseIP(g.IP)
+	if g.AsnNumber != 0 || ip == nil {
+		return
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	p.lookupASN(ip, g)
+}
+
+// Reload reopens any database whose file has changed since it was last
+// opened.  Lookups carry on with the old one until the new one is ready.
+func (p *MMDBProvider) Reload() error {
+	var city *maxminddb.Reader
+	var cityMod time.Time
+	var err error
+	if p.cityPath != "" {
+		if city, cityMod, err = reopenMMDB(p.cityPath, p.cityModTime()); err != nil {
+			return err
+		}
+	}
+	var asn *maxminddb.Reader
+	var asnMod time.Time
+	if p.asnPath != "" {
+		if asn, asnMod, err = reopenMMDB(p.asnPath, p.asnModTime()); err != nil {
+			if city != nil {
+				city.Close()
+			}
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if city != nil {
+		if p.city != nil {
+			p.city.Close()
+		}
+		p.city, p.cityMod = city, cityMod
+	}
+	if asn != nil {
+		if p.asn != nil {
+			p.asn.Close()
+		}
+		p.asn, p.asnMod = asn, asnMod
+	}
+	return nil
+}
+
+// Close stops reloading and closes the databases.
+func (p *MMDBProvider) Close() error {
+	p.stopOnce.Do(func() { close(p.stop) })
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	if p.city != nil {
+		err = p.city.Close()
+		p.city = nil
+	}
+	if p.asn != nil {
+		err = errors.Join(err, p.asn.Close())
+		p.asn = nil
+	}
+	return err
+}
+
+func (p *MMDBProvider) watch(every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-t.C:
+			if err := p.Reload(); err != nil {
+				rlog.Errorf("mmdb reload failed - %s", err)
+			}
+		}
+	}
+}
+
+func (p *MMDBProvider) cityModTime() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.cityMod
+}
+
+func (p *MMDBProvider) asnModTime() time.Time {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.asnMod
+}
+
+// reopenMMDB opens path if its modification time isn't since, returning a
+// nil reader if it is unchanged.
+func reopenMMDB(path string, since time.Time) (*maxminddb.Reader, time.Time, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, since, fmt.Errorf("mmdb: %w", err)
+	}
+	if fi.ModTime().Equal(since) {
+		return nil, since, nil
+	}
+	r, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, since, fmt.Errorf("mmdb: %s: %w", path, err)
+	}
+	return r, fi.ModTime(), nil
+}
@@ -0,0 +1,162 @@
+package me_geolocate
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+)
+
+func writeMMDB(t *testing.T, path, dbType, cidr string, rec mmdbtype.Map) {
+	t.Helper()
+	tree, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: dbType, IncludeReservedNetworks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, network, _ := net.ParseCIDR(cidr)
+	if err := tree.Insert(network, rec); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := tree.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func cityRecord(city string) mmdbtype.Map {
+	names := func(s string) mmdbtype.Map { return mmdbtype.Map{"en": mmdbtype.String(s)} }
+	return mmdbtype.Map{
+		"city":      mmdbtype.Map{"names": names(city)},
+		"continent": mmdbtype.Map{"code": mmdbtype.String("NA"), "names": names("North America")},
+		"country":   mmdbtype.Map{"iso_code": mmdbtype.String("US"), "names": names("United States")},
+		"location": mmdbtype.Map{
+			"latitude":  mmdbtype.Float64(37.751),
+			"longitude": mmdbtype.Float64(-97.822),
+			"time_zone": mmdbtype.String("America/Chicago"),
+		},
+		"postal":       mmdbtype.Map{"code": mmdbtype.String("67101")},
+		"subdivisions": mmdbtype.Slice{mmdbtype.Map{"names": names("Kansas")}},
+	}
+}
+
+func TestMMDBProvider(t *testing.T) {
+	dir := t.TempDir()
+	cityPath := filepath.Join(dir, "city.mmdb")
+	asnPath := filepath.Join(dir, "asn.mmdb")
+	writeMMDB(t, cityPath, "GeoLite2-City", "8.8.8.0/24", cityRecord("Wichita"))
+	writeMMDB(t, asnPath, "GeoLite2-ASN", "8.8.8.0/24", mmdbtype.Map{
+		"autonomous_system_number":       mmdbtype.Uint32(15169),
+		"autonomous_system_organization": mmdbtype.String("GOOGLE"),
+	})
+
+	p, err := NewMMDBProvider(cityPath, asnPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	geo := newGeoIPData("8.8.8.8")
+	if err := geo.lookupWith(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	want := GeoIPData{City: "Wichita", Region: "Kansas", CountryCode: "US", CountryName: "United States", ContinentCode: "NA",
+		PostalCode: "67101", TimezoneName: "America/Chicago", AsnNumber: 15169, Asn: "AS15169", AsnOrg: "GOOGLE", ISP: "GOOGLE", Provider: "mmdb"}
+	if geo.City != want.City || geo.Region != want.Region || geo.CountryCode != want.CountryCode || geo.CountryName != want.CountryName ||
+		geo.ContinentCode != want.ContinentCode || geo.PostalCode != want.PostalCode || geo.TimezoneName != want.TimezoneName ||
+		geo.AsnNumber != want.AsnNumber || geo.Asn != want.Asn || geo.AsnOrg != want.AsnOrg || geo.ISP != want.ISP ||
+		geo.Provider != want.Provider || !geo.Located {
+		t.Errorf("want: %+v\ngot: %+v\n", want, geo)
+	}
+	if geo.Latitude != 37.751 || geo.Longitude != -97.822 {
+		t.Errorf("want: 37.751 -97.822\ngot: %f %f\n", geo.Latitude, geo.Longitude)
+	}
+
+	miss := newGeoIPData("1.1.1.1")
+	if err := miss.lookupWith(context.Background(), p); err == nil || miss.Located {
+		t.Errorf("want: not located\ngot: %+v\n", miss)
+	}
+}
+
+func TestMMDBProviderReload(t *testing.T) {
+	cityPath := filepath.Join(t.TempDir(), "city.mmdb")
+	writeMMDB(t, cityPath, "GeoLite2-City", "8.8.8.0/24", cityRecord("Wichita"))
+
+	p, err := NewMMDBProvider(cityPath, "", 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	writeMMDB(t, cityPath, "GeoLite2-City", "8.8.8.0/24", cityRecord("Topeka"))
+	// make sure the change shows whatever the filesystem's mtime resolution
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(cityPath, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		geo := newGeoIPData("8.8.8.8")
+		if err := p.Lookup(context.Background(), &geo); err != nil {
+			t.Fatal(err)
+		}
+		if geo.City == "Topeka" {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("want: Topeka\ngot: %s\n", geo.City)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMMDBProviderMissingFile(t *testing.T) {
+	if _, err := NewMMDBProvider(filepath.Join(t.TempDir(), "nope.mmdb"), "", 0); err == nil {
+		t.Errorf("want: an error\ngot: nil\n")
+	}
+}
+
+func TestWithASNDatabase(t *testing.T) {
+	asnPath := filepath.Join(t.TempDir(), "asn.mmdb")
+	writeMMDB(t, asnPath, "GeoLite2-ASN", "8.8.8.0/24", mmdbtype.Map{
+		"autonomous_system_number":       mmdbtype.Uint32(15169),
+		"autonomous_system_organization": mmdbtype.String("GOOGLE"),
+	})
+	db, err := NewMMDBProvider("", asnPath, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	url := providerServer(t, `{"status":"success","countryCode":"US","isp":"Google LLC","query":"8.8.8.8"}`, nil)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithProvider(&IPAPIProvider{URL: url + "/%s"}), WithASNDatabase(db))
+	defer l.Close()
+
+	geo, _ := l.GetGeoData(context.Background(), "8.8.8.8")
+	if geo.AsnNumber != 15169 || geo.Asn != "AS15169" || geo.AsnOrg != "GOOGLE" || geo.ISP != "Google LLC" {
+		t.Errorf("want: AS15169 GOOGLE, ISP kept\ngot: %d %s %s %s\n", geo.AsnNumber, geo.Asn, geo.AsnOrg, geo.ISP)
+	}
+
+	if err := db.Lookup(context.Background(), &geo); err == nil {
+		t.Errorf("ASN-only lookup want: an error\ngot: nil\n")
+	}
+
+	// a background refresh of a stale entry enriches too
+	mem := NewMemoryCache(10)
+	mem.Set(context.Background(), "8.8.8.8", GeoIPData{IP: "8.8.8.8", CountryCode: "US", FetchedAt: time.Now().Add(-time.Hour)}, 0)
+	swr := NewGeoLocator(nil, WithCache(mem), WithProvider(&IPAPIProvider{URL: url + "/%s"}), WithASNDatabase(db), WithStaleAfter(time.Minute))
+	swr.GetGeoData(context.Background(), "8.8.8.8")
+	swr.Close()
+	if geo, _ := mem.Get(context.Background(), "8.8.8.8"); geo.AsnOrg != "GOOGLE" {
+		t.Errorf("refreshed want: GOOGLE\ngot: %+v\n", geo)
+	}
+}
@@ -0,0 +1,134 @@
+package me_geolocate
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/netip"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// overrideRule pins the geo data for every address in prefix.
+type overrideRule struct {
+	prefix netip.Prefix
+	geo    GeoIPData
+}
+
+var overrides atomic.Pointer[[]overrideRule] // longest prefix first
+var overridesPath string
+var overridesMu sync.Mutex // serializes loads
+
+// LoadOverrides reads static geo corrections from a JSON file, mapping IPs
+// or CIDRs to the data to answer for them instead of asking the provider:
+//
+//	{
+//	  "198.51.100.0/24": {"isp": "Example Corp", "country_code": "US", "city": "Dallas"},
+//	  "203.0.113.7":     {"isp": "Partner VPN", "country_code": "CA", "city": "Toronto"}
+//	}
+//
+// The values use GeoIPData's json names.  The most specific match wins.
+// A malformed file is an error and leaves the current overrides in place.
+// Calling it again (or ReloadOverrides) swaps in the new file, so it is
+// safe while lookups are running.  Locators from NewGeoLocator take theirs
+// from WithOverridesFile instead.
+func LoadOverrides(path string) error {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+
+	rules, err := readOverrides(path)
+	if err != nil {
+		return fmt.Errorf("LoadOverrides %w", err)
+	}
+	overrides.Store(&rules)
+	overridesPath = path
+	return nil
+}
+
+// ReloadOverrides re-reads the file last given to LoadOverrides.
+func ReloadOverrides() error {
+	overridesMu.Lock()
+	path := overridesPath
+	overridesMu.Unlock()
+	if path == "" {
+		return fmt.Errorf("ReloadOverrides: no overrides file loaded")
+	}
+	return LoadOverrides(path)
+}
+
+func parseOverrides(byt []byte) ([]overrideRule, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(byt, &raw); err != nil {
+		return nil, err
+	}
+
+	rules := make([]overrideRule, 0, len(raw))
+	for key, val := range raw {
+		prefix, err := netip.ParsePrefix(key)
+		if err != nil {
+			addr, aerr := netip.ParseAddr(key)
+			if aerr != nil {
+				return nil, fmt.Errorf("%q is not an IP or CIDR", key)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		prefix = prefix.Masked()
+
+		var geo GeoIPData
+		dec := json.NewDecoder(bytes.NewReader(val))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&geo); err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+		if cc := geo.CountryCode; cc != "" && len(cc) != 2 {
+			return nil, fmt.Errorf("%s: country_code %q is not two letters", key, cc)
+		}
+		if !geo.checkCoordinates() {
+			return nil, fmt.Errorf("%s: coordinates out of range", key)
+		}
+		rules = append(rules, overrideRule{prefix: prefix, geo: geo})
+	}
+
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].prefix.Bits() > rules[j].prefix.Bits()
+	})
+	return rules, nil
+}
+
+// readOverrides reads and validates the overrides file at path, see
+// LoadOverrides for its format.
+func readOverrides(path string) ([]overrideRule, error) {
+	byt, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := parseOverrides(byt)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rules, nil
+}
+
+// matchOverride returns the answer for ip from the most specific of
+// rules that covers it, if any does.
+func matchOverride(rules []overrideRule, ip string) (GeoIPData, bool) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return GeoIPData{}, false
+	}
+	addr = addr.Unmap()
+	for _, r := range rules {
+		if r.prefix.Contains(addr) {
+			geo := r.geo
+			geo.IP = ip
+			geo.Located = true
+			geo.Routable = true
+			geo.Success = true
+			geo.Provider = "override"
+			return geo, true
+		}
+	}
+	return GeoIPData{}, false
+}
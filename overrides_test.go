@@ -0,0 +1,105 @@
+package me_geolocate
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeOverrides(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadOverrides(t *testing.T) {
+	defer overrides.Store(nil)
+
+	path := writeOverrides(t, `{
+		"198.51.100.0/24": {"isp": "Example Corp", "country_code": "US", "city": "Dallas"},
+		"198.51.100.7":    {"isp": "Partner VPN", "country_code": "CA", "city": "Toronto"},
+		"2001:db8::/32":   {"isp": "Lab", "country_code": "DE"}
+	}`)
+	if err := LoadOverrides(path); err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+
+	tests := []struct{ ip, isp string }{
+		{"198.51.100.1", "Example Corp"},
+		{"198.51.100.7", "Partner VPN"}, // most specific wins
+		{"::ffff:198.51.100.9", "Example Corp"},
+		{"2001:db8::1", "Lab"},
+	}
+	for _, tt := range tests {
+		geo := GetGeoData(tt.ip)
+		if geo.ISP != tt.isp || geo.Provider != "override" || geo.IP != tt.ip {
+			t.Errorf("%s want: %s override\ngot: %s %s %s\n", tt.ip, tt.isp, geo.ISP, geo.Provider, geo.IP)
+		}
+	}
+	if _, ok := matchOverride(*overrides.Load(), "198.51.101.1"); ok {
+		t.Errorf("198.51.101.1 want: no override\ngot: override\n")
+	}
+
+	// reload picks up edits
+	os.WriteFile(path, []byte(`{"198.51.100.0/24": {"isp": "Renamed Corp"}}`), 0o644)
+	if err := ReloadOverrides(); err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+	if geo, _ := matchOverride(*overrides.Load(), "198.51.100.7"); geo.ISP != "Renamed Corp" {
+		t.Errorf("want: Renamed Corp\ngot: %s\n", geo.ISP)
+	}
+}
+
+func TestLoadOverridesInvalid(t *testing.T) {
+	defer overrides.Store(nil)
+
+	for _, body := range []string{
+		`not json`,
+		`{"not-a-cidr": {"isp": "x"}}`,
+		`{"10.0.0.0/8": {"isp": "x", "shoe_size": 11}}`,
+		`{"10.0.0.0/8": {"country_code": "USA"}}`,
+		`{"10.0.0.0/8": {"latitude": 999}}`,
+	} {
+		if err := LoadOverrides(writeOverrides(t, body)); err == nil {
+			t.Errorf("%s want: error\ngot: nil\n", body)
+		}
+	}
+	if overrides.Load() != nil {
+		t.Errorf("want failed loads to leave no overrides\ngot: %v\n", *overrides.Load())
+	}
+}
+
+func TestWithOverridesFile(t *testing.T) {
+	if err := LoadOverrides(writeOverrides(t, `{"198.51.100.0/24": {"isp": "Package Corp"}}`)); err != nil {
+		t.Fatal(err)
+	}
+	defer overrides.Store(nil)
+
+	path := writeOverrides(t, `{"203.0.113.0/24": {"isp": "Locator Corp", "country_code": "CA"}}`)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL("http://127.0.0.1:1/%s"), WithOverridesFile(path))
+	defer l.Close()
+	ctx := context.Background()
+
+	geo, err := l.GetGeoData(ctx, "203.0.113.7")
+	if err != nil || geo.ISP != "Locator Corp" || geo.Provider != "override" {
+		t.Errorf("want: Locator Corp override\ngot: %s %s %v\n", geo.ISP, geo.Provider, err)
+	}
+	geos, _ := l.GetGeoDataBatch(ctx, []string{"203.0.113.8"})
+	if geos[0].ISP != "Locator Corp" {
+		t.Errorf("batch want: Locator Corp\ngot: %s\n", geos[0].ISP)
+	}
+	// LoadOverrides is for the package-level functions only
+	if geo, _ := l.GetGeoData(ctx, "198.51.100.7"); geo.Provider == "override" {
+		t.Errorf("want LoadOverrides ignored\ngot: %s %s\n", geo.ISP, geo.Provider)
+	}
+
+	bad := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithOverridesFile(writeOverrides(t, `not json`)))
+	defer bad.Close()
+	if len(bad.overrides) != 0 {
+		t.Errorf("malformed file want: no overrides\ngot: %d\n", len(bad.overrides))
+	}
+}
@@ -0,0 +1,88 @@
+package me_geolocate
+
+import "sync"
+
+// poolQueue is how many tasks a worker pool holds waiting per worker.
+const poolQueue = 64
+
+// WithWorkerPool runs the locator's background work, SWR refreshes (see
+// WithStaleAfter) and cache-write retries (see WithCacheWriteRetry), on at
+// most size goroutines however many features are on.  Work beyond that
+// waits its turn; past 64 waiting per worker it is skipped, as a refresh
+// would be if one for the IP were already running.  Stats shows how
+// many are active and queued.  Retrying cache writes holds one worker
+// for as long as there are writes to retry.  Lookups a caller is waiting
+// on aren't background work.  By default each task gets its own
+// goroutine.
+func WithWorkerPool(size int) Option {
+	return func(l *GeoLocator) { l.pool = newWorkerPool(size) }
+}
+
+// workerPool runs tasks on at most size goroutines, started as needed.
+type workerPool struct {
+	mu     sync.Mutex
+	size   int
+	active int
+	queue  []func()
+}
+
+func newWorkerPool(size int) *workerPool {
+	return &workerPool{size: max(size, 1)}
+}
+
+// spawn runs task in the background, through l's pool if it has one, or
+// right away if WithSynchronous is set.  It is false if the pool is full
+// and task won't run.
+func (l *GeoLocator) spawn(task func()) bool {
+	if l.synchronous {
+		task()
+		return true
+	}
+	if l.pool == nil {
+		go task()
+		return true
+	}
+	return l.pool.submit(task)
+}
+
+func (p *workerPool) submit(task func()) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.active < p.size {
+		p.active++
+		go p.work(task)
+		return true
+	}
+	if len(p.queue) >= p.size*poolQueue {
+		return false
+	}
+	p.queue = append(p.queue, task)
+	return true
+}
+
+// work runs task, then whatever is queued, until the queue is empty.
+func (p *workerPool) work(task func()) {
+	for task != nil {
+		task()
+		p.mu.Lock()
+		task = nil
+		if len(p.queue) > 0 {
+			task = p.queue[0]
+			p.queue[0] = nil
+			p.queue = p.queue[1:]
+		} else {
+			p.active--
+		}
+		p.mu.Unlock()
+	}
+}
+
+// counts is how many tasks are running and waiting, 0 for a nil pool.
+func (p *workerPool) counts() (active, queued int) {
+	if p == nil {
+		return 0, 0
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.active, len(p.queue)
+}
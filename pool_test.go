@@ -0,0 +1,66 @@
+package me_geolocate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	p := newWorkerPool(1)
+	release := make(chan struct{})
+	ran := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		if !p.submit(func() { <-release; ran <- i }) {
+			t.Fatalf("task %d want: accepted\ngot: refused\n", i)
+		}
+	}
+	if active, queued := p.counts(); active != 1 || queued != 1 {
+		t.Errorf("want: 1 active 1 queued\ngot: %d %d\n", active, queued)
+	}
+	for i := 0; i < poolQueue-1; i++ {
+		p.submit(func() {})
+	}
+	if p.submit(func() {}) {
+		t.Errorf("want: a full queue refusing\ngot: accepted\n")
+	}
+	close(release)
+	if a, b := <-ran, <-ran; a != 0 || b != 1 {
+		t.Errorf("want: in order\ngot: %d %d\n", a, b)
+	}
+}
+
+func TestWithWorkerPool(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		ip := strings.TrimPrefix(r.URL.Path, "/")
+		fmt.Fprintf(w, `{"ip":%q,"isp":"Fresh ISP","country_code":"US","success":true}`, ip)
+	}))
+	defer srv.Close()
+
+	mem := NewMemoryCache(10)
+	ips := []string{"8.8.8.8", "1.1.1.1", "9.9.9.9"}
+	for _, ip := range ips {
+		mem.Set(context.Background(), ip, GeoIPData{IP: ip, ISP: "Old ISP", CountryCode: "US", FetchedAt: time.Now().Add(-time.Hour)}, 0)
+	}
+	l := NewGeoLocator(nil, WithCache(mem), WithLookupURL(srv.URL+"/%s"), WithStaleAfter(time.Minute), WithWorkerPool(1))
+	for _, ip := range ips {
+		l.GetGeoData(context.Background(), ip)
+	}
+	if s := l.Stats(); s.PoolActive != 1 || s.PoolQueued != 2 {
+		t.Errorf("want: 1 refresh running, 2 waiting\ngot: %d %d\n", s.PoolActive, s.PoolQueued)
+	}
+
+	close(release)
+	l.Close()
+	for _, ip := range ips {
+		if geo, _ := mem.Get(context.Background(), ip); geo.ISP != "Fresh ISP" {
+			t.Errorf("%s want: Fresh ISP\ngot: %s\n", ip, geo.ISP)
+		}
+	}
+}
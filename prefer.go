@@ -0,0 +1,48 @@
+package me_geolocate
+
+import "context"
+
+// CallOption adjusts a single lookup, see GetGeoDataWith.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	prefer string // provider name to try first, "" = the chain's order
+}
+
+// PreferProvider tries the provider called name, as in Provider.Name,
+// ahead of the rest of the chain, e.g. a paid one for a premium request.
+// Only a cache entry it answered counts as a hit.  If it fails and another
+// provider answers, the result has Degraded set.
+func PreferProvider(name string) CallOption {
+	return func(o *callOptions) { o.prefer = name }
+}
+
+// GetGeoDataWith is GetGeoData adjusted by opts.
+func (l *GeoLocator) GetGeoDataWith(ctx context.Context, ip string, opts ...CallOption) (GeoIPData, error) {
+	var co callOptions
+	for _, opt := range opts {
+		opt(&co)
+	}
+	return l.GetGeoData(context.WithValue(ctx, callKey{}, co), ip)
+}
+
+type callKey struct{}
+
+// preferred is the provider ctx's lookup should try first, "" if none.
+func preferred(ctx context.Context) string {
+	co, _ := ctx.Value(callKey{}).(callOptions)
+	return co.prefer
+}
+
+// providerOrder is the order lookup tries l's providers in for prefer.
+func (l *GeoLocator) providerOrder(prefer string) []int {
+	order := make([]int, 0, len(l.providers))
+	for i, p := range l.providers {
+		if prefer != "" && p.Name() == prefer {
+			order = append([]int{i}, order...)
+			continue
+		}
+		order = append(order, i)
+	}
+	return order
+}
@@ -0,0 +1,61 @@
+package me_geolocate
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestPreferProvider(t *testing.T) {
+	free := providerServer(t, `{"isp":"Free ISP","country_code":"US","success":true}`, nil)
+	var down atomic.Bool
+	var paidCalls atomic.Int32
+	paid := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paidCalls.Add(1)
+		if down.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		fmt.Fprint(w, `{"status":"success","countryCode":"US","isp":"Paid ISP","query":"8.8.8.8"}`)
+	}))
+	defer paid.Close()
+
+	mem := NewMemoryCache(10)
+	l := NewGeoLocator(nil, WithCache(mem),
+		WithProviderChain(&GeoIPLookupProvider{URL: free + "/%s"}, &IPAPIProvider{URL: paid.URL + "/%s"}))
+	defer l.Close()
+	ctx := context.Background()
+
+	// the preferred provider goes first though it is second in the chain
+	geo, err := l.GetGeoDataWith(ctx, "8.8.8.8", PreferProvider("ip-api.com"))
+	if err != nil || geo.ISP != "Paid ISP" || geo.Degraded {
+		t.Errorf("want: Paid ISP, not degraded\ngot: %s %v %v\n", geo.ISP, geo.Degraded, err)
+	}
+
+	// it fails, so the chain answers and the result says so
+	mem.Delete(ctx, "8.8.8.8")
+	down.Store(true)
+	geo, err = l.GetGeoDataWith(ctx, "8.8.8.8", PreferProvider("ip-api.com"))
+	if err != nil || geo.ISP != "Free ISP" || !geo.Degraded {
+		t.Errorf("want: Free ISP, degraded\ngot: %s %v %v\n", geo.ISP, geo.Degraded, err)
+	}
+	if cached, _ := mem.Get(ctx, "8.8.8.8"); cached.ISP != "Free ISP" || cached.Degraded {
+		t.Errorf("cached want: Free ISP, not degraded\ngot: %s %v\n", cached.ISP, cached.Degraded)
+	}
+
+	// a plain lookup takes the fallback's entry as it is
+	if geo, _ := l.GetGeoData(ctx, "8.8.8.8"); !geo.CacheHit || geo.Degraded {
+		t.Errorf("plain want: cache hit, not degraded\ngot: %v %v\n", geo.CacheHit, geo.Degraded)
+	}
+
+	// a preferred lookup doesn't, and tries the preferred provider again
+	down.Store(false)
+	calls := paidCalls.Load()
+	geo, _ = l.GetGeoDataWith(ctx, "8.8.8.8", PreferProvider("ip-api.com"))
+	if geo.ISP != "Paid ISP" || geo.CacheHit || paidCalls.Load() != calls+1 {
+		t.Errorf("want: Paid ISP from the provider\ngot: %s %v\n", geo.ISP, geo.CacheHit)
+	}
+}
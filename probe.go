@@ -0,0 +1,27 @@
+package me_geolocate
+
+import (
+	"context"
+	"time"
+)
+
+// probeIP is a well-known public address the provider always knows.
+const probeIP = "8.8.8.8"
+
+// ProbeProvider times a single provider lookup, for health dashboards and
+// synthetic monitoring, see GeoLocator.ProbeProvider.
+func ProbeProvider(ctx context.Context) (time.Duration, error) {
+	return std().ProbeProvider(ctx)
+}
+
+// ProbeProvider times a single lookup from the first provider in the
+// locator's chain, the one every lookup tries first.  It bypasses the
+// cache both ways, as well as retries, failover and the circuit breakers:
+// nothing is read and the answer isn't stored.  The latency is returned
+// even when the lookup fails.
+func (l *GeoLocator) ProbeProvider(ctx context.Context) (time.Duration, error) {
+	geo := newGeoIPData(probeIP)
+	start := time.Now()
+	err := geo.lookupWith(ctx, l.providers[0])
+	return time.Since(start), err
+}
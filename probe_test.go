@@ -0,0 +1,54 @@
+package me_geolocate
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestProbeProvider(t *testing.T) {
+	mr := useMiniredis(t)
+	useProvider(t, `{"ip":"8.8.8.8","isp":"Google LLC","success":true}`)
+
+	d, err := ProbeProvider(context.Background())
+	if err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+	if d <= 0 {
+		t.Errorf("want a positive latency\ngot: %s\n", d)
+	}
+	if len(mr.Keys()) != 0 {
+		t.Errorf("want nothing cached\ngot: %v\n", mr.Keys())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ProbeProvider(ctx); err == nil {
+		t.Errorf("cancelled want: error\ngot: nil\n")
+	}
+}
+
+func TestProbeProviderLocator(t *testing.T) {
+	var primary, fallback atomic.Int32
+	up := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primary.Add(1)
+		w.Write([]byte(`{"status":"success","countryCode":"US","isp":"Google LLC"}`))
+	}))
+	defer up.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fallback.Add(1)
+	}))
+	defer down.Close()
+	useProvider(t, `{"isp":"Google LLC","success":true}`)
+
+	l := NewGeoLocator(nil, WithProviderChain(&IPAPIProvider{URL: up.URL + "/%s"}, &IPInfoProvider{URL: down.URL + "/%s"}))
+	defer l.Close()
+	if _, err := l.ProbeProvider(context.Background()); err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+	if primary.Load() != 1 || fallback.Load() != 0 {
+		t.Errorf("want the first provider probed once\ngot: %d, fallback %d\n", primary.Load(), fallback.Load())
+	}
+}
@@ -0,0 +1,100 @@
+package me_geolocate
+
+import (
+	"time"
+
+	"github.com/pootwaddle/me_geolocate/geopb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ToProto converts geo to its protobuf form for gRPC handlers.
+func (geo GeoIPData) ToProto() *geopb.GeoIPData {
+	return &geopb.GeoIPData{
+		Ip:             geo.IP,
+		Isp:            geo.ISP,
+		Org:            geo.Org,
+		Hostname:       geo.Hostname,
+		Latitude:       geo.Latitude,
+		Longitude:      geo.Longitude,
+		PostalCode:     geo.PostalCode,
+		City:           geo.City,
+		CountryCode:    geo.CountryCode,
+		CountryName:    geo.CountryName,
+		ContinentCode:  geo.ContinentCode,
+		ContinentName:  geo.ContinentName,
+		Region:         geo.Region,
+		District:       geo.District,
+		TimezoneName:   geo.TimezoneName,
+		ConnectionType: geo.ConnectionType,
+		AsnNumber:      int64(geo.AsnNumber),
+		AsnOrg:         geo.AsnOrg,
+		Asn:            geo.Asn,
+		CurrencyCode:   geo.CurrencyCode,
+		CurrencyName:   geo.CurrencyName,
+		Success:        geo.Success,
+		Error:          geo.Error,
+		Premium:        geo.Premium,
+		Located:        geo.Located,
+		Routable:       geo.Routable,
+		Provider:       geo.Provider,
+		Block:          geo.Block,
+		CacheHit:       geo.CacheHit,
+		ReverseDns:     geo.ReverseDNS,
+		FetchedAt:      toTimestamp(geo.FetchedAt),
+		CountryOnly:    geo.CountryOnly,
+	}
+}
+
+// FromProto converts the protobuf form back to a GeoIPData.  A nil
+// message gives the zero value.
+func FromProto(p *geopb.GeoIPData) GeoIPData {
+	return GeoIPData{
+		IP:             p.GetIp(),
+		ISP:            p.GetIsp(),
+		Org:            p.GetOrg(),
+		Hostname:       p.GetHostname(),
+		Latitude:       p.GetLatitude(),
+		Longitude:      p.GetLongitude(),
+		PostalCode:     p.GetPostalCode(),
+		City:           p.GetCity(),
+		CountryCode:    p.GetCountryCode(),
+		CountryName:    p.GetCountryName(),
+		ContinentCode:  p.GetContinentCode(),
+		ContinentName:  p.GetContinentName(),
+		Region:         p.GetRegion(),
+		District:       p.GetDistrict(),
+		TimezoneName:   p.GetTimezoneName(),
+		ConnectionType: p.GetConnectionType(),
+		AsnNumber:      int(p.GetAsnNumber()),
+		AsnOrg:         p.GetAsnOrg(),
+		Asn:            p.GetAsn(),
+		CurrencyCode:   p.GetCurrencyCode(),
+		CurrencyName:   p.GetCurrencyName(),
+		Success:        p.GetSuccess(),
+		Error:          p.GetError(),
+		Premium:        p.GetPremium(),
+		Located:        p.GetLocated(),
+		Routable:       p.GetRoutable(),
+		Provider:       p.GetProvider(),
+		Block:          p.GetBlock(),
+		CacheHit:       p.GetCacheHit(),
+		ReverseDNS:     p.GetReverseDns(),
+		FetchedAt:      fromTimestamp(p.GetFetchedAt()),
+		CountryOnly:    p.GetCountryOnly(),
+	}
+}
+
+// toTimestamp leaves a zero time unset rather than sending year 1.
+func toTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+func fromTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts == nil {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
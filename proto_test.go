@@ -0,0 +1,74 @@
+package me_geolocate
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/pootwaddle/me_geolocate/geopb"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	geo := GeoIPData{
+		IP:             "47.190.31.12",
+		ISP:            "Frontier Communications Solutions",
+		Org:            "FTR3 FiOS-S Plano TX",
+		Hostname:       "static-47-190-31-12.dlls.tx.frontiernet.net",
+		Latitude:       33.02,
+		Longitude:      -96.6988,
+		PostalCode:     "75026",
+		City:           "Plano (Original Donation)",
+		CountryCode:    "US",
+		CountryName:    "United States",
+		ContinentCode:  "NA",
+		ContinentName:  "North America",
+		Region:         "Texas",
+		District:       "Collin",
+		TimezoneName:   "America/Chicago",
+		ConnectionType: "Corporate",
+		AsnNumber:      5650,
+		AsnOrg:         "Frontier Communications of America, Inc.",
+		Asn:            "AS5650",
+		CurrencyCode:   "USD",
+		CurrencyName:   "Dollar",
+		Success:        true,
+		Error:          "none",
+		Premium:        true,
+		Located:        true,
+		Routable:       true,
+		Provider:       providerName,
+		Block:          true,
+		CacheHit:       true,
+		ReverseDNS:     "static-47-190-31-12.dlls.tx.frontiernet.net",
+		FetchedAt:      time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+		CountryOnly:    true,
+	}
+
+	// through the wire format too, not just the struct copy
+	b, err := proto.Marshal(geo.ToProto())
+	if err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+	p := &geopb.GeoIPData{}
+	if err := proto.Unmarshal(b, p); err != nil {
+		t.Fatalf("want: nil\ngot: %s\n", err)
+	}
+
+	got := FromProto(p)
+	if !reflect.DeepEqual(geo, got) {
+		t.Errorf("want: %+v\ngot: %+v\n", geo, got)
+	}
+
+	// every cached struct field must be mapped, so adding one without a
+	// proto field shows up here
+	n := 0
+	for i := 0; i < reflect.TypeOf(geo).NumField(); i++ {
+		if reflect.TypeOf(geo).Field(i).Tag.Get("json") != "-" {
+			n++
+		}
+	}
+	if p.ProtoReflect().Descriptor().Fields().Len() != n {
+		t.Errorf("proto fields want: %d\ngot: %d\n", n, p.ProtoReflect().Descriptor().Fields().Len())
+	}
+}
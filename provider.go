@@ -0,0 +1,142 @@
+package me_geolocate
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/romana/rlog"
+)
+
+// Provider looks IPs up with a geolocation service.  Lookup fills in geo,
+// which arrives as the placeholder for geo.IP, from the service's answer.
+// If the service can't locate the IP, Lookup returns an error and leaves
+// the reason in geo.Error.  Name is recorded in GeoIPData.Provider.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, geo *GeoIPData) error
+}
+
+// lookupWith asks p about g.IP and applies the answer, subject to
+// SetProviderFields.  g is only changed on success, apart from the error
+// and any captured response headers.
+func (g *GeoIPData) lookupWith(ctx context.Context, p Provider) error {
+	answer := *g
+	if err := p.Lookup(ctx, &answer); err != nil {
+		g.Success = false
+		g.Error = answer.Error
+		if g.Error == "" {
+			g.Error = err.Error()
+		}
+		g.ProviderHeaders = answer.ProviderHeaders
+		return err
+	}
+	g.copyProviderFields(&answer)
+	g.ProviderHeaders = answer.ProviderHeaders
+	g.Located = true
+	g.Provider = p.Name()
+	g.FetchedAt = time.Now().UTC()
+	g.checkCoordinates()
+	g.roundCoordinates()
+
+	rlog.Debugf("parsed Geo answer for IP:%s from %s", logIP(g.IP), p.Name())
+	return nil
+}
+
+// providerGet GETs url and returns the body.  A status other than 200 is
+// recorded in g.Error, but the body is still returned since providers
+// explain failures there.  Network errors, 429s and 5xxs come back as a
+// retryableError instead.  Response headers are captured onto g.
+func providerGet(ctx context.Context, client *http.Client, url string, header http.Header, g *GeoIPData) ([]byte, error) {
+	if client == nil {
+		client = httpClient
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		g.Error = fmt.Sprintf("GetGeoData bad request for IP: %s - %s", g.IP, err)
+		return nil, errors.New(g.Error)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Accept-Encoding", "gzip")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("GetGeoData request failed for IP: %s - %w", g.IP, err)
+		g.Error = err.Error()
+		if ctx.Err() == nil && !errors.Is(err, ErrCertPinMismatch) {
+			return nil, &retryableError{err: err}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	g.captureHeaders(resp.Header)
+	recordStatus(ctx, resp.StatusCode)
+
+	if resp.Status != "200 OK" {
+		g.Error = fmt.Sprintf("GetGeoData received invalid response for IP: %s - %s", g.IP, resp.Status)
+		if after, ok := retryableStatus(resp); ok {
+			return nil, &retryableError{err: errors.New(g.Error), after: after}
+		}
+	}
+
+	var reader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			g.Error = fmt.Sprintf("Reading our reader failed - %s", err)
+			return nil, errors.New(g.Error)
+		}
+		defer zr.Close()
+		reader = zr
+	}
+
+	byt, err := io.ReadAll(reader)
+	if err != nil {
+		g.Error = fmt.Sprintf("Reading our reader failed - %s", err)
+		return nil, errors.New(g.Error)
+	}
+	return byt, nil
+}
+
+// GeoIPLookupProvider is json.geoiplookup.io, the default provider.  The
+// zero value uses the package's pooled client.
+type GeoIPLookupProvider struct {
+	Client *http.Client
+	URL    string // format with one %s for the IP, default https://json.geoiplookup.io/%s
+}
+
+func (p *GeoIPLookupProvider) Name() string { return providerName }
+
+func (p *GeoIPLookupProvider) Lookup(ctx context.Context, g *GeoIPData) error {
+	url := p.URL
+	if url == "" {
+		url = lookupURL
+	}
+	byt, err := providerGet(ctx, p.Client, fmt.Sprintf(url, g.IP), nil, g)
+	if err != nil {
+		return err
+	}
+
+	answer := *g
+	if err := json.Unmarshal(byt, &answer); err != nil {
+		g.Error = fmt.Sprintf("GetGeoData could not parse response for IP: %s - %s", g.IP, err)
+		return errors.New(g.Error)
+	}
+	if !answer.Success || answer.Error != "" {
+		g.Success = false
+		if answer.Error != "" {
+			g.Error = answer.Error
+		}
+		return fmt.Errorf("GetGeoData provider did not locate IP: %s - %s", g.IP, g.Error)
+	}
+	*g = answer
+	return nil
+}
@@ -0,0 +1,169 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func providerServer(t *testing.T, body string, check func(r *http.Request)) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if check != nil {
+			check(r)
+		}
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func TestIPAPIProvider(t *testing.T) {
+	url := providerServer(t, `{"status":"success","continent":"North America","continentCode":"NA","country":"United States","countryCode":"US","regionName":"California","city":"Mountain View","zip":"94043","lat":37.422,"lon":-122.085,"timezone":"America/Los_Angeles","isp":"Google LLC","org":"Google Public DNS","as":"AS15169 Google LLC","query":"8.8.8.8"}`, nil)
+
+	geo := newGeoIPData("8.8.8.8")
+	if err := geo.lookupWith(context.Background(), &IPAPIProvider{URL: url + "/%s"}); err != nil {
+		t.Fatal(err)
+	}
+	want := GeoIPData{IP: "8.8.8.8", ISP: "Google LLC", Org: "Google Public DNS", CountryCode: "US", CountryName: "United States", City: "Mountain View", Region: "California", AsnNumber: 15169, Asn: "AS15169", AsnOrg: "Google LLC", Provider: "ip-api.com"}
+	if geo.ISP != want.ISP || geo.Org != want.Org || geo.CountryCode != want.CountryCode || geo.CountryName != want.CountryName ||
+		geo.City != want.City || geo.Region != want.Region || geo.AsnNumber != want.AsnNumber || geo.Asn != want.Asn ||
+		geo.AsnOrg != want.AsnOrg || geo.Provider != want.Provider || !geo.Success || !geo.Located {
+		t.Errorf("want: %+v\ngot: %+v\n", want, geo)
+	}
+	if geo.Latitude != 37.422 || geo.Longitude != -122.085 {
+		t.Errorf("want: 37.422 -122.085\ngot: %f %f\n", geo.Latitude, geo.Longitude)
+	}
+}
+
+func TestIPAPIProviderFail(t *testing.T) {
+	url := providerServer(t, `{"status":"fail","message":"private range","query":"10.0.0.1"}`, nil)
+
+	geo := newGeoIPData("8.8.8.8")
+	if err := geo.lookupWith(context.Background(), &IPAPIProvider{URL: url + "/%s"}); err == nil {
+		t.Fatalf("want an error\ngot: nil\n")
+	}
+	if geo.Error != "private range" || geo.Located || geo.ISP != "-----" {
+		t.Errorf("want: private range, placeholder kept\ngot: %+v\n", geo)
+	}
+}
+
+func TestIPInfoProvider(t *testing.T) {
+	url := providerServer(t, `{"ip":"8.8.8.8","hostname":"dns.google","city":"Mountain View","region":"California","country":"US","loc":"37.4056,-122.0775","org":"AS15169 Google LLC","postal":"94043","timezone":"America/Los_Angeles"}`,
+		func(r *http.Request) {
+			if got := r.Header.Get("Authorization"); got != "Bearer secret" {
+				t.Errorf("want: Bearer secret\ngot: %s\n", got)
+			}
+		})
+
+	geo := newGeoIPData("8.8.8.8")
+	if err := geo.lookupWith(context.Background(), &IPInfoProvider{Token: "secret", URL: url + "/%s/json"}); err != nil {
+		t.Fatal(err)
+	}
+	if geo.CountryCode != "US" || geo.Hostname != "dns.google" || geo.ISP != "Google LLC" || geo.AsnNumber != 15169 || geo.Provider != "ipinfo.io" {
+		t.Errorf("want: US dns.google Google LLC 15169 ipinfo.io\ngot: %+v\n", geo)
+	}
+	if geo.Latitude != 37.4056 || geo.Longitude != -122.0775 {
+		t.Errorf("want: 37.4056 -122.0775\ngot: %f %f\n", geo.Latitude, geo.Longitude)
+	}
+}
+
+func TestIPInfoProviderBogon(t *testing.T) {
+	url := providerServer(t, `{"ip":"10.0.0.1","bogon":true}`, nil)
+
+	geo := newGeoIPData("10.0.0.1")
+	if err := geo.lookupWith(context.Background(), &IPInfoProvider{URL: url + "/%s/json"}); err == nil {
+		t.Fatalf("want an error\ngot: nil\n")
+	}
+	if want := "Invalid public IPv4 or IPv6 address"; geo.Error != want {
+		t.Errorf("want: %s\ngot: %s\n", want, geo.Error)
+	}
+}
+
+func TestParseAS(t *testing.T) {
+	tests := []struct {
+		in       string
+		n        int
+		asn, org string
+	}{
+		{"AS15169 Google LLC", 15169, "AS15169", "Google LLC"},
+		{"AS13335", 13335, "AS13335", ""},
+		{"Some Org", 0, "", "Some Org"},
+		{"", 0, "", ""},
+	}
+	for _, tt := range tests {
+		n, asn, org := parseAS(tt.in)
+		if n != tt.n || asn != tt.asn || org != tt.org {
+			t.Errorf("%q want: %d %s %s\ngot: %d %s %s\n", tt.in, tt.n, tt.asn, tt.org, n, asn, org)
+		}
+	}
+}
+
+func TestWithProvider(t *testing.T) {
+	url := providerServer(t, `{"ip":"8.8.8.8","country":"US","org":"AS15169 Google LLC"}`, nil)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithProvider(&IPInfoProvider{URL: url + "/%s/json"}))
+	defer l.Close()
+
+	geo, _ := l.GetGeoData(context.Background(), "8.8.8.8")
+	if geo.Provider != "ipinfo.io" || geo.CountryCode != "US" {
+		t.Errorf("want: ipinfo.io US\ngot: %s %s\n", geo.Provider, geo.CountryCode)
+	}
+}
+
+func TestWithProviderChain(t *testing.T) {
+	down := providerServer(t, `oops`, nil)
+	miss := providerServer(t, `{"status":"fail","message":"reserved range"}`, nil)
+	good := providerServer(t, `{"ip":"8.8.8.8","country":"US","org":"AS15169 Google LLC"}`, nil)
+
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithProviderChain(
+		&GeoIPLookupProvider{URL: down + "/%s"},
+		&IPAPIProvider{URL: miss + "/%s"},
+		&IPInfoProvider{URL: good + "/%s/json"},
+	))
+	defer l.Close()
+
+	geo, _ := l.GetGeoData(context.Background(), "8.8.8.8")
+	if geo.Provider != "ipinfo.io" || geo.CountryCode != "US" || geo.Error != "" {
+		t.Errorf("want: ipinfo.io US, no error\ngot: %s %s %q\n", geo.Provider, geo.CountryCode, geo.Error)
+	}
+
+	l = NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithProviderChain(
+		&GeoIPLookupProvider{URL: down + "/%s"},
+		&IPAPIProvider{URL: miss + "/%s"},
+	))
+	defer l.Close()
+
+	geo, _ = l.GetGeoData(context.Background(), "8.8.8.8")
+	if geo.Located || geo.Error != "reserved range" {
+		t.Errorf("want: not located, last error\ngot: %v %q\n", geo.Located, geo.Error)
+	}
+}
+
+func TestWithHTTPTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"), WithHTTPTimeout(20*time.Millisecond))
+	defer l.Close()
+	start := time.Now()
+	if _, err := l.GetGeoData(context.Background(), "8.8.8.8"); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Errorf("want: ErrUpstreamUnavailable\ngot: %v\n", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("want: timed out after 20ms\ngot: %s\n", d)
+	}
+	// a nil client means the shared one, not a panic
+	NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithHTTPClient(nil), WithHTTPTimeout(time.Second)).Close()
+	if httpClient.Timeout != providerTimeout {
+		t.Errorf("want: shared client left alone\ngot: %s\n", httpClient.Timeout)
+	}
+}
@@ -0,0 +1,46 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"golang.org/x/time/rate"
+)
+
+// ErrRateLimited is returned when a lookup would go over the provider rate
+// limit set with WithRateLimit.
+var ErrRateLimited = errors.New("me_geolocate: rate limited")
+
+// WithRateLimit holds provider calls to requestsPerSecond, with bursts of
+// up to burst, so the provider doesn't throttle us.  Every provider
+// attempt counts, including failovers.  Lookups over the limit wait their
+// turn; see WithRateLimitReject to fail them instead.  A burst below 1 is
+// taken as 1, as a limiter with no burst would never let a call through.
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	return func(l *GeoLocator) { l.limiter = rate.NewLimiter(rate.Limit(requestsPerSecond), max(burst, 1)) }
+}
+
+// WithRateLimitReject fails lookups over the WithRateLimit limit with
+// ErrRateLimited rather than waiting.  Like other failures they aren't
+// cached.
+func WithRateLimitReject() Option {
+	return func(l *GeoLocator) { l.rejectLimited = true }
+}
+
+// allow waits for, or checks, the rate limit before a provider call.
+func (l *GeoLocator) allow(ctx context.Context) error {
+	if l.limiter == nil {
+		return nil
+	}
+	if l.rejectLimited {
+		if !l.limiter.Allow() {
+			return ErrRateLimited
+		}
+		return nil
+	}
+	if err := l.limiter.Wait(ctx); err != nil {
+		return fmt.Errorf("%w - %w", ErrRateLimited, err)
+	}
+	return nil
+}
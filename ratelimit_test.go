@@ -0,0 +1,50 @@
+package me_geolocate
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWithRateLimitReject(t *testing.T) {
+	useProvider(t, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(lookupURL),
+		WithRateLimit(0.001, 1), WithRateLimitReject())
+
+	if geo, _ := l.GetGeoData(context.Background(), "8.8.8.8"); !geo.Located {
+		t.Fatalf("want: first lookup located\ngot: %+v\n", geo)
+	}
+	geo, _ := l.GetGeoData(context.Background(), "1.1.1.1")
+	if geo.Located || geo.Error != ErrRateLimited.Error() {
+		t.Errorf("want: %s\ngot: %v %s\n", ErrRateLimited, geo.Located, geo.Error)
+	}
+	// cache hits don't count against the limit
+	if geo, _ := l.GetGeoData(context.Background(), "8.8.8.8"); !geo.CacheHit {
+		t.Errorf("want: cache hit\ngot: %+v\n", geo)
+	}
+}
+
+func TestWithRateLimitQueue(t *testing.T) {
+	useProvider(t, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(lookupURL), WithRateLimit(20, 1))
+
+	start := time.Now()
+	for _, ip := range []string{"8.8.8.8", "8.8.4.4", "1.1.1.1"} {
+		if geo, _ := l.GetGeoData(context.Background(), ip); !geo.Located {
+			t.Errorf("%s want: located\ngot: %s\n", ip, geo.Error)
+		}
+	}
+	if took := time.Since(start); took < 90*time.Millisecond {
+		t.Errorf("want: at least 100ms for 3 lookups at 20/s\ngot: %s\n", took)
+	}
+}
+
+func TestWithRateLimitZeroBurst(t *testing.T) {
+	useProvider(t, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(lookupURL),
+		WithRateLimit(0.001, 0), WithRateLimitReject())
+
+	if geo, _ := l.GetGeoData(context.Background(), "8.8.8.8"); !geo.Located {
+		t.Errorf("want: located with burst 0 taken as 1\ngot: %s\n", geo.Error)
+	}
+}
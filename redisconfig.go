@@ -0,0 +1,140 @@
+package me_geolocate
+
+import (
+	"crypto/tls"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisConfig says how to reach the cache, for deployments REDIS_CONF
+// alone can't describe.
+type RedisConfig struct {
+	// Addrs are host:port or redis:// URLs: the instances to shard
+	// across, the Sentinels if MasterName is set, or the seed nodes if
+	// Cluster is.
+	Addrs      []string
+	MasterName string // Sentinel master name, switches to Sentinel mode
+	Cluster    bool   // Redis Cluster mode
+
+	// Username, Password and TLSConfig override what the URLs say.
+	Username         string
+	Password         string
+	SentinelUsername string
+	SentinelPassword string
+	DB               int // -1 = from the URL; Cluster only has DB 0
+	TLSConfig        *tls.Config
+}
+
+// redisConfigFromEnv is the RedisConfig for conf, the REDIS_CONF
+// addresses, and the environment:
+//
+//	REDIS_SENTINEL_MASTER    master name; conf lists the Sentinels
+//	REDIS_CLUSTER            true to treat conf as Redis Cluster seed nodes
+//	REDIS_USERNAME           credentials for the Redis servers
+//	REDIS_PASSWORD
+//	REDIS_SENTINEL_USERNAME  credentials for the Sentinels
+//	REDIS_SENTINEL_PASSWORD
+//	REDIS_TLS                true to connect with TLS
+func redisConfigFromEnv(conf string) RedisConfig {
+	cfg := RedisConfig{
+		MasterName:       os.Getenv("REDIS_SENTINEL_MASTER"),
+		Username:         os.Getenv("REDIS_USERNAME"),
+		Password:         os.Getenv("REDIS_PASSWORD"),
+		SentinelUsername: os.Getenv("REDIS_SENTINEL_USERNAME"),
+		SentinelPassword: os.Getenv("REDIS_SENTINEL_PASSWORD"),
+		DB:               -1,
+	}
+	cfg.Cluster, _ = strconv.ParseBool(os.Getenv("REDIS_CLUSTER"))
+	if useTLS, _ := strconv.ParseBool(os.Getenv("REDIS_TLS")); useTLS {
+		cfg.TLSConfig = &tls.Config{}
+	}
+	for _, c := range strings.Split(conf, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			cfg.Addrs = append(cfg.Addrs, c)
+		}
+	}
+	return cfg
+}
+
+// WithRedisConfig connects the cache as cfg says, e.g. through Sentinel
+// or to a Redis Cluster.  It takes precedence over WithRedisAddr, and
+// WithCache over it.
+func WithRedisConfig(cfg RedisConfig) Option {
+	return func(l *GeoLocator) { l.redisConfig = &cfg }
+}
+
+// NewRedisClient connects to the Redis described by cfg: a Sentinel
+// failover client if MasterName is set, a cluster client if Cluster is,
+// and otherwise one server or a ring sharded across Addrs.
+func NewRedisClient(cfg RedisConfig) redis.UniversalClient {
+	switch {
+	case cfg.MasterName != "":
+		opts := &redis.FailoverOptions{
+			MasterName:       cfg.MasterName,
+			SentinelAddrs:    cfg.hostPorts(),
+			SentinelUsername: cfg.SentinelUsername,
+			SentinelPassword: cfg.SentinelPassword,
+		}
+		node := cfg.nodeOptions()
+		opts.Username, opts.Password, opts.DB, opts.TLSConfig = node.Username, node.Password, node.DB, node.TLSConfig
+		opts.ContextTimeoutEnabled = true
+		return redis.NewFailoverClient(opts)
+	case cfg.Cluster:
+		node := cfg.nodeOptions()
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:     cfg.hostPorts(),
+			Username:  node.Username,
+			Password:  node.Password,
+			TLSConfig: node.TLSConfig,
+
+			ContextTimeoutEnabled: true,
+		})
+	}
+	return newShardedClient(cfg)
+}
+
+// apply puts cfg's overrides onto opts.  Calls always honour their
+// ctx's deadline, so WithLookupTimeout covers the cache too.
+func (cfg RedisConfig) apply(opts *redis.Options) {
+	opts.ContextTimeoutEnabled = true
+	if cfg.Username != "" {
+		opts.Username = cfg.Username
+	}
+	if cfg.Password != "" {
+		opts.Password = cfg.Password
+	}
+	if cfg.DB >= 0 {
+		opts.DB = cfg.DB
+	}
+	if cfg.TLSConfig != nil {
+		opts.TLSConfig = cfg.TLSConfig
+	}
+}
+
+// hostPorts is Addrs without any URL trimmings.
+func (cfg RedisConfig) hostPorts() []string {
+	addrs := make([]string, 0, len(cfg.Addrs))
+	for _, a := range cfg.Addrs {
+		if opts, err := redisOptions(a); err == nil {
+			a = opts.Addr
+		}
+		addrs = append(addrs, a)
+	}
+	return addrs
+}
+
+// nodeOptions are the settings for the Redis servers behind Sentinel or
+// Cluster: the first URL's, with cfg's overrides.
+func (cfg RedisConfig) nodeOptions() *redis.Options {
+	opts := &redis.Options{}
+	if len(cfg.Addrs) > 0 {
+		if o, err := redisOptions(cfg.Addrs[0]); err == nil {
+			opts = o
+		}
+	}
+	cfg.apply(opts)
+	return opts
+}
@@ -0,0 +1,74 @@
+package me_geolocate
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisConfigFromEnv(t *testing.T) {
+	t.Setenv("REDIS_SENTINEL_MASTER", "geo")
+	t.Setenv("REDIS_PASSWORD", "s3cret")
+	t.Setenv("REDIS_TLS", "true")
+
+	cfg := redisConfigFromEnv("10.0.0.1:26379, 10.0.0.2:26379")
+	if cfg.MasterName != "geo" || cfg.Password != "s3cret" || cfg.TLSConfig == nil || cfg.DB != -1 {
+		t.Errorf("want: master geo, password, TLS, DB -1\ngot: %+v\n", cfg)
+	}
+	if want := []string{"10.0.0.1:26379", "10.0.0.2:26379"}; !reflect.DeepEqual(want, cfg.Addrs) {
+		t.Errorf("want: %v\ngot: %v\n", want, cfg.Addrs)
+	}
+}
+
+func TestNewRedisClient(t *testing.T) {
+	c := NewRedisClient(RedisConfig{Addrs: []string{"redis://old@127.0.0.1:6379/2"}, Username: "geo", Password: "s3cret", DB: -1})
+	defer c.Close()
+	opts := c.(*redis.Client).Options()
+	if opts.Username != "geo" || opts.Password != "s3cret" || opts.DB != 2 {
+		t.Errorf("want: geo s3cret DB 2\ngot: %s %s %d\n", opts.Username, opts.Password, opts.DB)
+	}
+
+	cc := NewRedisClient(RedisConfig{Addrs: []string{"redis://10.0.0.1:7000", "10.0.0.2:7000"}, Cluster: true, Password: "s3cret"})
+	defer cc.Close()
+	cluster, ok := cc.(*redis.ClusterClient)
+	if !ok {
+		t.Fatalf("want: *redis.ClusterClient\ngot: %T\n", cc)
+	}
+	if want := []string{"10.0.0.1:7000", "10.0.0.2:7000"}; !reflect.DeepEqual(want, cluster.Options().Addrs) || cluster.Options().Password != "s3cret" {
+		t.Errorf("want: %v with password\ngot: %+v\n", want, cluster.Options())
+	}
+}
+
+func TestWithRedisConfig(t *testing.T) {
+	mr := miniredis.RunT(t)
+	mr.RequireUserAuth("geo", "s3cret")
+	url := providerServer(t, `{"isp":"Google LLC","country_code":"US","success":true}`, nil)
+	l := NewGeoLocator(nil, WithRedisAddr(""), WithLookupURL(url+"/%s"),
+		WithRedisConfig(RedisConfig{Addrs: []string{mr.Addr()}, Username: "geo", Password: "s3cret", DB: -1}))
+	defer l.Close()
+
+	l.GetGeoData(context.Background(), "8.8.8.8")
+	if !mr.Exists("geo:8.8.8.8") {
+		t.Errorf("want: cached with the configured credentials\ngot: %v\n", mr.Keys())
+	}
+}
+
+func TestWithRedisClient(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	url := providerServer(t, `{"isp":"Google LLC","country_code":"US","success":true}`, nil)
+	l := NewGeoLocator(nil, WithRedisAddr("127.0.0.1:1"), WithRedisClient(client), WithLookupURL(url+"/%s"))
+
+	l.GetGeoData(context.Background(), "8.8.8.8")
+	if !mr.Exists("geo:8.8.8.8") {
+		t.Errorf("want: cached through the injected client\ngot: %v\n", mr.Keys())
+	}
+	l.Close()
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Errorf("want: client left open\ngot: %v\n", err)
+	}
+}
@@ -0,0 +1,39 @@
+package me_geolocate
+
+import (
+	"context"
+	"fmt"
+)
+
+// RefreshAndDiff force-refreshes ip from the provider and reports whether
+// it moved, e.g. as an account-takeover signal, see GeoLocator.RefreshAndDiff.
+func RefreshAndDiff(ctx context.Context, ip string) (old, current GeoIPData, changed bool, err error) {
+	return std().RefreshAndDiff(ctx, ip)
+}
+
+// RefreshAndDiff is Refresh, also returning what the cache held before.
+// old is the cached entry (the placeholder if nothing), current is the
+// fresh answer, which replaces it.  changed compares CountryCode, City and
+// ISP, and is only true if there was a cached entry to compare against.
+// If the provider fails the cache is left alone.
+func (l *GeoLocator) RefreshAndDiff(ctx context.Context, ip string) (old, current GeoIPData, changed bool, err error) {
+	old = newGeoIPData(ip)
+	if l.cache == nil {
+		return old, old, false, ErrNoCache
+	}
+	if _, ok := parseAddr(old.IP); !ok {
+		return old, old, false, fmt.Errorf("%w: %q", ErrInvalidIP, ip)
+	}
+	if cached, err := l.cache.Get(ctx, cacheKey(old.IP)); err == nil {
+		old.fromCache(cached)
+		old.CacheHit = true
+	}
+
+	current, err = l.Refresh(ctx, ip)
+	if err != nil {
+		return old, current, false, err
+	}
+	changed = old.CacheHit &&
+		(old.CountryCode != current.CountryCode || old.City != current.City || old.ISP != current.ISP)
+	return old, current, changed, nil
+}
@@ -0,0 +1,83 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRefreshAndDiff(t *testing.T) {
+	useMiniredis(t)
+	ctx := context.Background()
+
+	useProvider(t, `{"isp":"Frontier","city":"Plano","country_code":"US","success":true}`)
+	_, _, changed, err := RefreshAndDiff(ctx, "47.190.31.12")
+	if err != nil || changed {
+		t.Fatalf("first refresh want: unchanged, nil\ngot: %v, %v\n", changed, err)
+	}
+
+	_, _, changed, err = RefreshAndDiff(ctx, "47.190.31.12")
+	if err != nil || changed {
+		t.Errorf("same answer want: unchanged, nil\ngot: %v, %v\n", changed, err)
+	}
+
+	useProvider(t, `{"isp":"Frontier","city":"Lagos","country_code":"NG","success":true}`)
+	old, current, changed, err := RefreshAndDiff(ctx, "47.190.31.12")
+	if err != nil || !changed {
+		t.Errorf("moved want: changed, nil\ngot: %v, %v\n", changed, err)
+	}
+	if old.CountryCode != "US" || current.CountryCode != "NG" {
+		t.Errorf("want: US -> NG\ngot: %s -> %s\n", old.CountryCode, current.CountryCode)
+	}
+	if geo := GetGeoData("47.190.31.12"); geo.CountryCode != "NG" || !geo.CacheHit {
+		t.Errorf("want cache updated to NG\ngot: %s hit=%v\n", geo.CountryCode, geo.CacheHit)
+	}
+
+	// a failing provider leaves the cache as it was
+	useProvider(t, `{"success":false,"error":"rate limited"}`)
+	if _, _, _, err = RefreshAndDiff(ctx, "47.190.31.12"); err == nil {
+		t.Errorf("failed refresh want: error\ngot: nil\n")
+	}
+	if geo := GetGeoData("47.190.31.12"); geo.CountryCode != "NG" {
+		t.Errorf("want: NG kept\ngot: %s\n", geo.CountryCode)
+	}
+}
+
+// movingProvider answers every IP with country, counting its calls.
+type movingProvider struct {
+	country atomic.Value
+	calls   atomic.Int32
+}
+
+func (p *movingProvider) Name() string { return "moving" }
+
+func (p *movingProvider) Lookup(ctx context.Context, geo *GeoIPData) error {
+	p.calls.Add(1)
+	geo.ISP, geo.CountryCode, geo.Success = "Frontier", p.country.Load().(string), true
+	return nil
+}
+
+func TestRefreshAndDiffLocator(t *testing.T) {
+	p := &movingProvider{}
+	p.country.Store("US")
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLocalCache(10, time.Hour), WithProvider(p))
+	defer l.Close()
+	ctx := context.Background()
+
+	if _, _, _, err := l.RefreshAndDiff(ctx, "not-an-ip"); !errors.Is(err, ErrInvalidIP) || p.calls.Load() != 0 {
+		t.Errorf("invalid want: %s, no provider call\ngot: %v %d\n", ErrInvalidIP, err, p.calls.Load())
+	}
+
+	l.GetGeoData(ctx, "47.190.31.12")
+	p.country.Store("NG")
+	old, current, changed, err := l.RefreshAndDiff(ctx, "47.190.31.12")
+	if err != nil || !changed || old.CountryCode != "US" || current.Provider != "moving" {
+		t.Errorf("want: changed from US through the locator's provider\ngot: %v %s %s %v\n", changed, old.CountryCode, current.Provider, err)
+	}
+	// the near cache doesn't keep the old answer
+	if geo, _ := l.GetGeoData(ctx, "47.190.31.12"); geo.CountryCode != "NG" || !geo.CacheHit {
+		t.Errorf("want: NG from the cache\ngot: %s %v\n", geo.CountryCode, geo.CacheHit)
+	}
+}
@@ -0,0 +1,84 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy says how often to retry a provider call that failed in a way
+// that may pass: a network error or timeout, a 429 or a 5xx.  Answers that
+// don't locate the IP are never retried.
+type RetryPolicy struct {
+	MaxAttempts int           // tries per provider, including the first; below 2 means no retries
+	BaseDelay   time.Duration // wait before the first retry, doubled for each one after
+	MaxDelay    time.Duration // cap on the wait, 0 = no cap
+	Jitter      float64       // fraction of each wait that is randomized, 0 to 1
+}
+
+// WithRetry retries transient provider failures according to p.  A
+// Retry-After on a 429 or 503 is honoured if it asks for a longer wait.
+func WithRetry(p RetryPolicy) Option {
+	return func(l *GeoLocator) { l.retry = p }
+}
+
+// retryableError is a provider failure worth another try.  after is how
+// long the provider asked us to wait, if it said.
+type retryableError struct {
+	err   error
+	after time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
+// retryableStatus reports whether a provider response with this status
+// is worth retrying, with the wait it asked for.
+func retryableStatus(resp *http.Response) (time.Duration, bool) {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		return 0, false
+	}
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0, true
+	}
+	return time.Duration(secs) * time.Second, true
+}
+
+// backoff is the wait before retry number attempt (1 for the first), or
+// false if err shouldn't be retried or the attempts are used up.
+func (p RetryPolicy) backoff(attempt int, err error) (time.Duration, bool) {
+	var re *retryableError
+	if attempt >= p.MaxAttempts || !errors.As(err, &re) {
+		return 0, false
+	}
+	d := p.BaseDelay << (attempt - 1)
+	if d < 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		j := time.Duration(p.Jitter * float64(d))
+		if j > 0 {
+			d = d - j + time.Duration(rand.Int63n(int64(2*j)))
+		}
+	}
+	if re.after > d {
+		d = re.after
+	}
+	return d, true
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
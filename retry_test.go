@@ -0,0 +1,67 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithRetry(t *testing.T) {
+	tests := []struct {
+		name   string
+		status []int // per call, then 200
+		calls  int32
+		ok     bool
+	}{
+		{"5xx then ok", []int{503, 502}, 3, true},
+		{"429 then ok", []int{429}, 2, true},
+		{"gives up", []int{500, 500, 500, 500}, 3, false},
+		{"400 not retried", []int{400}, 1, false},
+	}
+
+	for _, tt := range tests {
+		var calls atomic.Int32
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := int(calls.Add(1))
+			if n <= len(tt.status) {
+				w.WriteHeader(tt.status[n-1])
+				return
+			}
+			fmt.Fprint(w, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+		}))
+		l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(srv.URL+"/%s"),
+			WithRetry(RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, Jitter: 0.5}))
+
+		geo, _ := l.GetGeoData(context.Background(), "8.8.8.8")
+		if geo.Located != tt.ok || calls.Load() != tt.calls {
+			t.Errorf("%s want: %v after %d calls\ngot: %v after %d calls - %s\n", tt.name, tt.ok, tt.calls, geo.Located, calls.Load(), geo.Error)
+		}
+		srv.Close()
+	}
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 5, BaseDelay: 10 * time.Millisecond, MaxDelay: 30 * time.Millisecond}
+	transient := &retryableError{err: errors.New("503")}
+
+	for attempt, want := range []time.Duration{10, 20, 30, 30} {
+		got, ok := p.backoff(attempt+1, transient)
+		if !ok || got != want*time.Millisecond {
+			t.Errorf("attempt %d want: %dms\ngot: %s %v\n", attempt+1, want, got, ok)
+		}
+	}
+	if _, ok := p.backoff(5, transient); ok {
+		t.Errorf("want: no retry after MaxAttempts\ngot: retry\n")
+	}
+	if _, ok := p.backoff(1, errors.New("not located")); ok {
+		t.Errorf("want: no retry for a non-transient error\ngot: retry\n")
+	}
+	if got, _ := p.backoff(1, &retryableError{err: transient, after: time.Second}); got != time.Second {
+		t.Errorf("want: Retry-After 1s\ngot: %s\n", got)
+	}
+}
@@ -0,0 +1,46 @@
+package me_geolocate
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/romana/rlog"
+)
+
+var reverseDNS bool // see SetReverseDNS
+var reverseDNSTimeout = 2 * time.Second
+var resolver = net.DefaultResolver
+
+// SetResolver sets the DNS resolver used for hostname lookups such as the
+// reverse DNS one, e.g. to use particular DNS servers or timeouts rather
+// than the OS setup.  nil goes back to net.DefaultResolver.
+func SetResolver(r *net.Resolver) {
+	if r == nil {
+		r = net.DefaultResolver
+	}
+	resolver = r
+}
+
+// SetReverseDNS turns on a PTR lookup for routable IPs that miss the cache.
+// The name lands in ReverseDNS and is cached along with the geo data.  The
+// PTR lookup is bounded by the lookup's ctx, and 2s at most; a failed or
+// slow one just leaves ReverseDNS empty.
+func SetReverseDNS(on bool) {
+	reverseDNS = on
+}
+
+// lookupReverseDNS fills in g.ReverseDNS, taking no longer than ctx allows
+// and at most reverseDNSTimeout.
+func (g *GeoIPData) lookupReverseDNS(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, reverseDNSTimeout)
+	defer cancel()
+
+	names, err := resolver.LookupAddr(ctx, g.IP)
+	if err != nil || len(names) == 0 {
+		rlog.Debugf("No reverse DNS for %s - %s", logIP(g.IP), redactErr(err, g.IP))
+		return
+	}
+	g.ReverseDNS = strings.TrimSuffix(names[0], ".")
+}
@@ -0,0 +1,83 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSetResolver(t *testing.T) {
+	var dials atomic.Int32
+	SetResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dials.Add(1)
+			return nil, errors.New("stub dialer")
+		},
+	})
+	defer SetResolver(nil)
+
+	geo := GeoIPData{IP: "8.8.8.8"}
+	geo.lookupReverseDNS(context.Background())
+	if dials.Load() == 0 {
+		t.Errorf("want the custom resolver used\ngot: no dials\n")
+	}
+	if geo.ReverseDNS != "" {
+		t.Errorf("want: empty on failure\ngot: %s\n", geo.ReverseDNS)
+	}
+}
+
+func TestSetReverseDNS(t *testing.T) {
+	useMiniredis(t)
+	useProvider(t, `{"isp":"Google LLC","country_code":"US","success":true}`)
+	var dials atomic.Int32
+	SetResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			dials.Add(1)
+			return nil, errors.New("stub dialer")
+		},
+	})
+	defer SetResolver(nil)
+
+	GetGeoData("8.8.8.8")
+	if n := dials.Load(); n != 0 {
+		t.Errorf("off want: no PTR lookup\ngot: %d dials\n", n)
+	}
+
+	SetReverseDNS(true)
+	defer SetReverseDNS(false)
+	if geo := GetGeoData("1.1.1.1"); !geo.Located || geo.ReverseDNS != "" {
+		t.Errorf("failed PTR want: located, no name\ngot: %v %q\n", geo.Located, geo.ReverseDNS)
+	}
+	if dials.Load() == 0 {
+		t.Errorf("on want: a PTR lookup on a miss\ngot: no dials\n")
+	}
+	dials.Store(0)
+	if geo := GetGeoData("1.1.1.1"); !geo.CacheHit || dials.Load() != 0 {
+		t.Errorf("cache hit want: no PTR lookup\ngot: %v %d dials\n", geo.CacheHit, dials.Load())
+	}
+}
+
+func TestReverseDNSContext(t *testing.T) {
+	SetResolver(&net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+	})
+	defer SetResolver(nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	geo := GeoIPData{IP: "8.8.8.8"}
+	geo.lookupReverseDNS(ctx)
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("want: done by the caller's 50ms deadline\ngot: %s\n", took)
+	}
+}
@@ -0,0 +1,95 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Tier is a coarse risk rating for an IP.
+type Tier int
+
+const (
+	TierLow Tier = iota
+	TierMedium
+	TierHigh
+)
+
+func (t Tier) String() string {
+	switch t {
+	case TierLow:
+		return "low"
+	case TierMedium:
+		return "medium"
+	case TierHigh:
+		return "high"
+	}
+	return fmt.Sprintf("Tier(%d)", int(t))
+}
+
+// RiskRules drives RiskTier.  The zero value rates everything low.
+type RiskRules struct {
+	HighRiskCountries   []string // country codes rated high
+	MediumRiskCountries []string // country codes rated medium
+	// connection types rated high, matched case-insensitively as substrings
+	// of ConnectionType, e.g. "hosting", "vpn", "tor".  VPN and Tor can only
+	// be caught this way if the provider reports them in connection_type.
+	HighRiskConnectionTypes []string
+	NonRoutable             Tier // local, non-routable and reserved addresses
+	UnknownCountry          Tier // located without a country, or lookup failed
+}
+
+// RiskTier looks up ip and rates it against rules, see GeoLocator.RiskTier.
+func RiskTier(ctx context.Context, ip string, rules RiskRules) (Tier, GeoIPData, error) {
+	return std().RiskTier(ctx, ip, rules)
+}
+
+// RiskTier looks up ip and rates it against rules, returning the rating
+// along with the data it was based on.  The highest matching rule wins.
+// Local, non-routable and reserved addresses get the NonRoutable tier
+// without an error.  If the lookup fails, ip isn't an IP included, the
+// UnknownCountry tier comes back with GetGeoData's error.
+func (l *GeoLocator) RiskTier(ctx context.Context, ip string, rules RiskRules) (Tier, GeoIPData, error) {
+	geo, err := l.GetGeoData(ctx, ip)
+	switch {
+	case errors.Is(err, ErrNonRoutable):
+		return rules.NonRoutable, geo, nil
+	case err != nil:
+		return rules.UnknownCountry, geo, err
+	case !geo.Routable:
+		// a local network, which isn't an error
+		return rules.NonRoutable, geo, nil
+	}
+
+	tier := TierLow
+	raise := func(t Tier) {
+		if t > tier {
+			tier = t
+		}
+	}
+	switch cc := geo.CountryCode; {
+	case unknownCountry(cc):
+		raise(rules.UnknownCountry)
+	case hasFold(rules.HighRiskCountries, cc):
+		raise(TierHigh)
+	case hasFold(rules.MediumRiskCountries, cc):
+		raise(TierMedium)
+	}
+	conn := strings.ToLower(geo.ConnectionType)
+	for _, c := range rules.HighRiskConnectionTypes {
+		if c != "" && strings.Contains(conn, strings.ToLower(c)) {
+			raise(TierHigh)
+		}
+	}
+	return tier, geo, nil
+}
+
+func hasFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRiskTier(t *testing.T) {
+	useMiniredis(t)
+	ctx := context.Background()
+	rules := RiskRules{
+		HighRiskCountries:       []string{"KP"},
+		MediumRiskCountries:     []string{"ru"},
+		HighRiskConnectionTypes: []string{"hosting"},
+		NonRoutable:             TierMedium,
+		UnknownCountry:          TierMedium,
+	}
+
+	tests := []struct {
+		body string
+		ip   string
+		want Tier
+	}{
+		{`{"country_code":"US","connection_type":"Cable/DSL","success":true}`, "8.8.8.1", TierLow},
+		{`{"country_code":"RU","connection_type":"Cable/DSL","success":true}`, "8.8.8.2", TierMedium},
+		{`{"country_code":"KP","success":true}`, "8.8.8.3", TierHigh},
+		{`{"country_code":"US","connection_type":"Hosting/Data Center","success":true}`, "8.8.8.4", TierHigh},
+		{`{"country_code":"","success":true}`, "8.8.8.5", TierMedium},
+		{`{"success":true}`, "10.0.0.1", TierMedium},
+	}
+	for _, tt := range tests {
+		useProvider(t, tt.body)
+		got, _, err := RiskTier(ctx, tt.ip, rules)
+		if err != nil || got != tt.want {
+			t.Errorf("%s want: %s\ngot: %s %v\n", tt.body, tt.want, got, err)
+		}
+	}
+
+	useProvider(t, `{"success":false,"error":"rate limited"}`)
+	if got, _, err := RiskTier(ctx, "8.8.8.6", rules); !errors.Is(err, ErrUpstreamUnavailable) || got != TierMedium {
+		t.Errorf("failed lookup want: medium + ErrUpstreamUnavailable\ngot: %s %v\n", got, err)
+	}
+	if _, _, err := RiskTier(ctx, "nope", rules); !errors.Is(err, ErrInvalidIP) {
+		t.Errorf("want: ErrInvalidIP\ngot: %v\n", err)
+	}
+}
+
+func TestRiskTierLocalNetwork(t *testing.T) {
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)),
+		WithLocalNetworks([]LocalNetRule{{CIDR: "192.168.0.0/16", ISP: "Home LAN", City: "Lewisville", Country: "US"}}))
+	defer l.Close()
+
+	got, geo, err := l.RiskTier(context.Background(), "192.168.1.20", RiskRules{NonRoutable: TierHigh})
+	if err != nil || got != TierHigh || geo.Provider != "local" {
+		t.Errorf("want: high for the local network\ngot: %s %s %v\n", got, geo.Provider, err)
+	}
+}
@@ -0,0 +1,81 @@
+package me_geolocate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxServerBatch caps how many IPs one POST /v1/geoip/batch may ask about.
+const maxServerBatch = 1000
+
+// Server serves lookups from a Locator over HTTP, for programs that
+// can't link the package:
+//
+//	GET  /v1/geoip/{ip}     one GeoIPData
+//	POST /v1/geoip/batch    a JSON array of IPs in, an array of GeoIPData out
+//	GET  /healthz           200 "ok"
+//
+// Errors come back as {"error": "..."}: a 4xx status for a bad request,
+// or 503 if a batch couldn't be finished, e.g. no cache or the request
+// timed out.  A single lookup that fails otherwise still answers 200 with
+// the placeholder, its Error field saying why.
+type Server struct {
+	locator Locator
+	mux     *http.ServeMux
+}
+
+// NewServer builds a Server answering from l.  Closing l is up to the
+// caller.
+func NewServer(l Locator) *Server {
+	s := &Server{locator: l, mux: http.NewServeMux()}
+	s.mux.HandleFunc("GET /v1/geoip/{ip}", s.lookup)
+	s.mux.HandleFunc("POST /v1/geoip/batch", s.batch)
+	s.mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) lookup(w http.ResponseWriter, r *http.Request) {
+	ip := r.PathValue("ip")
+	geo, err := s.locator.GetGeoData(r.Context(), ip)
+	if errors.Is(err, ErrInvalidIP) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid IP address %q", ip))
+		return
+	}
+	writeJSON(w, http.StatusOK, geo)
+}
+
+func (s *Server) batch(w http.ResponseWriter, r *http.Request) {
+	var ips []string
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&ips); err != nil {
+		writeError(w, http.StatusBadRequest, "body must be a JSON array of IPs: "+err.Error())
+		return
+	}
+	if len(ips) > maxServerBatch {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("at most %d IPs per batch", maxServerBatch))
+		return
+	}
+	results, err := s.locator.GetGeoDataBatch(r.Context(), ips)
+	if err != nil {
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
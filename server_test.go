@@ -0,0 +1,84 @@
+package me_geolocate
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func testServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	url := providerServer(t, `{"ip":"8.8.8.8","country":"US","org":"AS15169 Google LLC"}`, nil)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithProvider(&IPInfoProvider{URL: url + "/%s/json"}))
+	t.Cleanup(func() { l.Close() })
+	srv := httptest.NewServer(NewServer(l))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestServerLookup(t *testing.T) {
+	srv := testServer(t)
+
+	resp, err := http.Get(srv.URL + "/v1/geoip/8.8.8.8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var geo GeoIPData
+	if err := json.NewDecoder(resp.Body).Decode(&geo); err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 || geo.CountryCode != "US" || geo.Provider != "ipinfo.io" {
+		t.Errorf("want: 200 US ipinfo.io\ngot: %d %s %s\n", resp.StatusCode, geo.CountryCode, geo.Provider)
+	}
+
+	resp, err = http.Get(srv.URL + "/v1/geoip/nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("want: 400\ngot: %d\n", resp.StatusCode)
+	}
+}
+
+func TestServerBatch(t *testing.T) {
+	srv := testServer(t)
+
+	resp, err := http.Post(srv.URL+"/v1/geoip/batch", "application/json", strings.NewReader(`["8.8.8.8","10.0.0.1"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var results []GeoIPData
+	if err := json.NewDecoder(resp.Body).Decode(&results); err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 || results[0].CountryCode != "US" || results[1].Provider != "non-routable" {
+		t.Errorf("want: US, non-routable\ngot: %+v\n", results)
+	}
+
+	resp, err = http.Post(srv.URL+"/v1/geoip/batch", "application/json", strings.NewReader(`{"ip":"8.8.8.8"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("want: 400\ngot: %d\n", resp.StatusCode)
+	}
+}
+
+func TestServerHealthz(t *testing.T) {
+	srv := testServer(t)
+
+	resp, err := http.Get(srv.URL + "/healthz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Errorf("want: 200\ngot: %d\n", resp.StatusCode)
+	}
+}
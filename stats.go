@@ -0,0 +1,81 @@
+package me_geolocate
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+// Stats is a snapshot of a locator's counters, see GeoLocator.Stats.
+type Stats struct {
+	Hits           int64 // lookups answered from the cache
+	Misses         int64 // lookups the cache couldn't answer
+	ProviderErrors int64 // failed provider calls, retries included
+	InFlight       int64 // provider calls underway
+	WritesQueued   int64 // failed cache writes waiting to be retried, see WithCacheWriteRetry
+	WritesDropped  int64 // failed cache writes given up on
+	PoolActive     int64 // background tasks running, see WithWorkerPool
+	PoolQueued     int64 // background tasks waiting for a worker
+	EventsDropped  int64 // results the event channel had no room for, see WithEventChannel
+}
+
+type counters struct {
+	hits, misses, providerErrors, inFlight atomic.Int64
+	writesDropped                          atomic.Int64
+	eventsDropped                          atomic.Uint64
+}
+
+// Stats returns the locator's counters since it was built.  They are
+// kept whether or not WithMetricsRegistry or WithExpvar is used.
+func (l *GeoLocator) Stats() Stats {
+	active, queued := l.pool.counts()
+	return Stats{
+		Hits:           l.counters.hits.Load(),
+		Misses:         l.counters.misses.Load(),
+		ProviderErrors: l.counters.providerErrors.Load(),
+		InFlight:       l.counters.inFlight.Load(),
+		WritesQueued:   int64(l.writes.len()),
+		WritesDropped:  l.counters.writesDropped.Load(),
+		PoolActive:     int64(active),
+		PoolQueued:     int64(queued),
+		EventsDropped:  int64(l.eventDrops.Load()),
+	}
+}
+
+// cacheResult counts a cache lookup, in Stats and the metrics.
+func (l *GeoLocator) cacheResult(hit bool) {
+	if hit {
+		l.counters.hits.Add(1)
+	} else {
+		l.counters.misses.Add(1)
+	}
+	l.metrics.cacheResult(hit)
+}
+
+// expvarName is the expvar map WithExpvar publishes.
+const expvarName = "me_geolocate"
+
+var expvarMap *expvar.Map
+var expvarOnce sync.Once
+
+// WithExpvar publishes the locator's Stats as the expvar map
+// "me_geolocate" (hits, misses, provider_errors, in_flight), for
+// monitoring through /debug/vars without Prometheus.  expvar names are
+// process-wide, so only one locator should turn it on; if more do, the
+// map shows the last one built.
+func WithExpvar(on bool) Option {
+	return func(l *GeoLocator) { l.expvar = on }
+}
+
+// publishExpvar points the expvar map at l's counters.
+func (l *GeoLocator) publishExpvar() {
+	expvarOnce.Do(func() { expvarMap = expvar.NewMap(expvarName) })
+	for name, c := range map[string]*atomic.Int64{
+		"hits":            &l.counters.hits,
+		"misses":          &l.counters.misses,
+		"provider_errors": &l.counters.providerErrors,
+		"in_flight":       &l.counters.inFlight,
+	} {
+		expvarMap.Set(name, expvar.Func(func() interface{} { return c.Load() }))
+	}
+}
@@ -0,0 +1,39 @@
+package me_geolocate
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	url := providerServer(t, `{"isp":"Google LLC","country_code":"US","success":true}`, nil)
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(url+"/%s"), WithExpvar(true))
+	defer l.Close()
+	bad := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL("http://127.0.0.1:1/%s"))
+	defer bad.Close()
+
+	ctx := context.Background()
+	l.GetGeoData(ctx, "8.8.8.8")
+	l.GetGeoData(ctx, "8.8.8.8")
+	l.GetGeoDataBatch(ctx, []string{"8.8.8.8", "1.1.1.1"})
+	bad.GetGeoData(ctx, "8.8.8.8")
+
+	want := Stats{Hits: 2, Misses: 2}
+	if got := l.Stats(); got != want {
+		t.Errorf("want: %+v\ngot: %+v\n", want, got)
+	}
+	want = Stats{Misses: 1, ProviderErrors: 1}
+	if got := bad.Stats(); got != want {
+		t.Errorf("want: %+v\ngot: %+v\n", want, got)
+	}
+
+	var published map[string]int64
+	if err := json.Unmarshal([]byte(expvar.Get(expvarName).String()), &published); err != nil {
+		t.Fatal(err)
+	}
+	if published["hits"] != 2 || published["misses"] != 2 || published["provider_errors"] != 0 || published["in_flight"] != 0 {
+		t.Errorf("expvar want: hits 2 misses 2\ngot: %v\n", published)
+	}
+}
@@ -0,0 +1,39 @@
+package me_geolocate
+
+import "fmt"
+
+// SummarizeResults is a one line report on a batch of lookups, for logs
+// and cron output, e.g.
+//
+//	resolved 950/1000 (720 cache, 230 fetched), 50 errors, top country US (412)
+//
+// Ties for top country go to the alphabetically first code; with no known
+// country it reads "top country -- (0)".
+func SummarizeResults(results map[string]GeoIPData) string {
+	var resolved, cached, errored int
+	countries := make(map[string]int)
+	for _, geo := range results {
+		if geo.Located {
+			resolved++
+			if geo.CacheHit {
+				cached++
+			}
+		}
+		if geo.Error != "" {
+			errored++
+		}
+		if !unknownCountry(geo.CountryCode) {
+			countries[geo.CountryCode]++
+		}
+	}
+
+	top, topN := "--", 0
+	for cc, n := range countries {
+		if n > topN || (n == topN && cc < top) {
+			top, topN = cc, n
+		}
+	}
+
+	return fmt.Sprintf("resolved %d/%d (%d cache, %d fetched), %d errors, top country %s (%d)",
+		resolved, len(results), cached, resolved-cached, errored, top, topN)
+}
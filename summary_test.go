@@ -0,0 +1,22 @@
+package me_geolocate
+
+import "testing"
+
+func TestSummarizeResults(t *testing.T) {
+	results := map[string]GeoIPData{
+		"8.8.8.8":     {Located: true, CacheHit: true, CountryCode: "US"},
+		"8.8.4.4":     {Located: true, CountryCode: "US"},
+		"1.1.1.1":     {Located: true, CacheHit: true, CountryCode: "AU"},
+		"81.2.69.160": {Located: true, CountryCode: "GB"},
+		"10.0.0.1":    {CountryCode: "--", Error: "Invalid public IPv4 or IPv6 address"},
+	}
+	want := "resolved 4/5 (2 cache, 2 fetched), 1 errors, top country US (2)"
+	if got := SummarizeResults(results); want != got {
+		t.Errorf("want: %s\ngot: %s\n", want, got)
+	}
+
+	want = "resolved 0/0 (0 cache, 0 fetched), 0 errors, top country -- (0)"
+	if got := SummarizeResults(nil); want != got {
+		t.Errorf("want: %s\ngot: %s\n", want, got)
+	}
+}
@@ -0,0 +1,163 @@
+package me_geolocate
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// how long a background refresh may take, see WithStaleAfter
+const revalidateTimeout = 30 * time.Second
+
+// defaults for WithRefreshBackoff
+const (
+	refreshBackoffBase       = 10 * time.Second
+	refreshBackoffMax        = 10 * time.Minute
+	refreshBackoffConcurrent = 4
+)
+
+// WithStaleAfter keeps answering from cache entries older than d, but
+// refreshes them from the provider in the background so the next lookup
+// gets current data without anyone waiting.  Age is measured from
+// FetchedAt; entries cached before that was recorded never go stale.  If
+// the refresh fails the old entry stays.  Close waits for refreshes still
+// running, and WithBaseContext's context cancels them.
+func WithStaleAfter(d time.Duration) Option {
+	return func(l *GeoLocator) { l.staleAfter = d }
+}
+
+// WithRefreshBackoff spaces out the background refreshes of an IP whose
+// last refresh failed, so a provider outage isn't made worse while stale
+// entries are still being served: the next try waits base, doubling with
+// each failure up to max, and at most concurrent refreshes of such IPs
+// run at once.  The defaults are 10s, 10m and 4.
+func WithRefreshBackoff(base, max time.Duration, concurrent int) Option {
+	return func(l *GeoLocator) {
+		l.backoff.base, l.backoff.max, l.backoff.concurrent = base, max, concurrent
+	}
+}
+
+// revalidateIfStale starts a background refresh of geo if it is stale.
+// Only one refresh per IP runs at a time.
+func (l *GeoLocator) revalidateIfStale(geo GeoIPData) {
+	if l.staleAfter <= 0 || geo.FetchedAt.IsZero() || time.Since(geo.FetchedAt) < l.staleAfter {
+		return
+	}
+	failing, ok := l.backoff.start(geo.IP)
+	if !ok {
+		l.debugf("GetGeoData background refresh backing off for IP: %s", logIP(geo.IP))
+		return
+	}
+	if !l.startBackground() {
+		l.backoff.finish(failing)
+		return
+	}
+	started := l.spawn(func() {
+		defer l.refreshes.Done()
+		defer l.backoff.finish(failing)
+		l.flight.Do("revalidate "+geo.IP, func() (interface{}, error) {
+			ctx, cancel := l.backgroundContext(context.Background(), revalidateTimeout)
+			defer cancel()
+			// a refresh that waited its turn in WithWorkerPool may find
+			// an earlier one already did the job
+			if cur, err := l.cache.Get(ctx, cacheKey(geo.IP)); err == nil && cur.FetchedAt.After(geo.FetchedAt) {
+				return nil, nil
+			}
+
+			fresh := newGeoIPData(geo.IP)
+			if reverseDNS {
+				fresh.lookupReverseDNS(ctx)
+			}
+			err := l.lookup(ctx, &fresh)
+			if wait := l.backoff.record(geo.IP, err); err != nil {
+				l.warnf("GetGeoData background refresh failed for IP: %s - %s", logIP(geo.IP), redactErr(err, geo.IP))
+				l.debugf("GetGeoData background refresh of IP: %s waits %s before the next try", logIP(geo.IP), wait)
+				return nil, nil
+			}
+			if l.asnDB != nil {
+				l.asnDB.enrichASN(&fresh)
+			}
+			fresh.add2Cache(ctx, l.cache, l.currentTTL())
+			return nil, nil
+		})
+	})
+	if !started {
+		l.backoff.finish(failing)
+		l.refreshes.Done()
+	}
+}
+
+// refreshBackoff tracks the IPs whose background refresh failed, see
+// WithRefreshBackoff.  The zero value uses the defaults.
+type refreshBackoff struct {
+	mu         sync.Mutex
+	base, max  time.Duration
+	concurrent int
+	failed     map[string]refreshFailure
+	running    int // refreshes of failed IPs underway
+}
+
+type refreshFailure struct {
+	failures int
+	next     time.Time // no refresh before this
+}
+
+// start reports whether ip may be refreshed now, and whether the refresh
+// counts against the concurrent limit, in which case finish must be
+// called with failing once it is done.
+func (b *refreshBackoff) start(ip string) (failing, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	f, failing := b.failed[ip]
+	if !failing {
+		return false, true
+	}
+	concurrent := b.concurrent
+	if concurrent <= 0 {
+		concurrent = refreshBackoffConcurrent
+	}
+	if time.Now().Before(f.next) || b.running >= concurrent {
+		return true, false
+	}
+	b.running++
+	return true, true
+}
+
+func (b *refreshBackoff) finish(failing bool) {
+	if !failing {
+		return
+	}
+	b.mu.Lock()
+	b.running--
+	b.mu.Unlock()
+}
+
+// record notes how a refresh of ip went, returning how long the next one
+// must wait.
+func (b *refreshBackoff) record(ip string, err error) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		delete(b.failed, ip)
+		return 0
+	}
+	base, limit := b.base, b.max
+	if base <= 0 {
+		base = refreshBackoffBase
+	}
+	if limit <= 0 {
+		limit = refreshBackoffMax
+	}
+	f := b.failed[ip]
+	f.failures++
+	wait := base << (f.failures - 1)
+	if wait <= 0 || wait > limit {
+		wait = limit
+	}
+	f.next = time.Now().Add(wait)
+	if b.failed == nil {
+		b.failed = make(map[string]refreshFailure)
+	}
+	b.failed[ip] = f
+	return wait
+}
@@ -0,0 +1,95 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWithStaleAfter(t *testing.T) {
+	useProvider(t, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	ctx := context.Background()
+	mem := NewMemoryCache(10)
+	old := time.Now().Add(-40 * 24 * time.Hour).UTC()
+	mem.Set(ctx, "8.8.8.8", GeoIPData{IP: "8.8.8.8", ISP: "Old ISP", CountryCode: "US", FetchedAt: old}, 0)
+	mem.Set(ctx, "1.1.1.1", GeoIPData{IP: "1.1.1.1", ISP: "Legacy", CountryCode: "AU"}, 0)
+
+	l := NewGeoLocator(nil, WithCache(mem), WithLookupURL(lookupURL), WithStaleAfter(30*24*time.Hour))
+
+	if geo, _ := l.GetGeoData(context.Background(), "8.8.8.8"); geo.ISP != "Old ISP" || !geo.CacheHit {
+		t.Errorf("want: stale entry served\ngot: %s %v\n", geo.ISP, geo.CacheHit)
+	}
+	l.GetGeoData(context.Background(), "1.1.1.1")
+	l.Close() // waits for the refresh
+
+	fresh, _ := mem.Get(ctx, "8.8.8.8")
+	if fresh.ISP != "Google LLC" || !fresh.FetchedAt.After(old) {
+		t.Errorf("want: refreshed in the background\ngot: %s %s\n", fresh.ISP, fresh.FetchedAt)
+	}
+	if legacy, _ := mem.Get(ctx, "1.1.1.1"); legacy.ISP != "Legacy" {
+		t.Errorf("want: entry without FetchedAt left alone\ngot: %s\n", legacy.ISP)
+	}
+}
+
+func TestWithRefreshBackoff(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+	mem := NewMemoryCache(10)
+	mem.Set(ctx, "8.8.8.8", GeoIPData{IP: "8.8.8.8", ISP: "Old ISP", CountryCode: "US", FetchedAt: time.Now().Add(-time.Hour)}, 0)
+
+	l := NewGeoLocator(nil, WithCache(mem), WithLookupURL(srv.URL+"/%s"), WithStaleAfter(time.Minute),
+		WithSynchronous(true), WithRefreshBackoff(time.Hour, time.Hour, 1))
+	defer l.Close()
+	for i := 0; i < 3; i++ {
+		if geo, _ := l.GetGeoData(ctx, "8.8.8.8"); geo.ISP != "Old ISP" {
+			t.Errorf("want: Old ISP served\ngot: %s\n", geo.ISP)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("want: 1 refresh, then backing off\ngot: %d\n", n)
+	}
+}
+
+func TestRefreshBackoff(t *testing.T) {
+	b := refreshBackoff{base: time.Second, max: 3 * time.Second, concurrent: 1}
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		if got := b.record("8.8.8.8", errors.New("down")); got != want {
+			t.Errorf("failure %d want: %s\ngot: %s\n", i+1, want, got)
+		}
+	}
+	if _, ok := b.start("8.8.8.8"); ok {
+		t.Errorf("want: backing off\ngot: refresh allowed\n")
+	}
+
+	// due failing IPs share the concurrent limit, others don't count
+	b.failed["8.8.8.8"] = refreshFailure{failures: 1}
+	b.failed["1.1.1.1"] = refreshFailure{failures: 1}
+	failing, ok := b.start("8.8.8.8")
+	if !failing || !ok {
+		t.Fatalf("want: a failing refresh allowed\ngot: %v %v\n", failing, ok)
+	}
+	if _, ok := b.start("1.1.1.1"); ok {
+		t.Errorf("want: over the concurrent limit\ngot: allowed\n")
+	}
+	if failing, ok := b.start("9.9.9.9"); failing || !ok {
+		t.Errorf("want: a healthy IP allowed\ngot: %v %v\n", failing, ok)
+	}
+	b.finish(true)
+	if _, ok := b.start("1.1.1.1"); !ok {
+		t.Errorf("want: allowed once the other finished\ngot: refused\n")
+	}
+
+	b.record("8.8.8.8", nil)
+	if failing, ok := b.start("8.8.8.8"); failing || !ok {
+		t.Errorf("want: cleared by a success\ngot: %v %v\n", failing, ok)
+	}
+}
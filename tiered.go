@@ -0,0 +1,128 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var stdNear *MemoryCache // see SetLocalCache
+var stdNearTTL time.Duration
+
+// TieredCache puts an in-process MemoryCache in front of another Cache,
+// usually Redis.  Hot IPs are answered without a round trip, and keep
+// being answered while the far cache is unreachable.  Writes go to both.
+type TieredCache struct {
+	near    *MemoryCache
+	far     Cache
+	nearTTL time.Duration // always positive, see NewTieredCache
+}
+
+// defaultNearTTL is how long near entries live when no ttl is given.
+const defaultNearTTL = time.Minute
+
+// NewTieredCache fronts far with an LRU of size entries, each kept for at
+// most ttl so changes made through other processes, such as an
+// Invalidate or a short-lived failure entry expiring, are picked up.  A
+// ttl of 0 means a minute; near entries always expire, since the far
+// entry's remaining lifetime isn't known when it is read.
+func NewTieredCache(far Cache, size int, ttl time.Duration) *TieredCache {
+	return &TieredCache{near: NewMemoryCache(size), far: far, nearTTL: nearTTL(ttl)}
+}
+
+// nearTTL is ttl, or defaultNearTTL if it isn't positive.
+func nearTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return defaultNearTTL
+	}
+	return ttl
+}
+
+// SetLocalCache fronts the package-level cache with an in-process LRU of
+// size entries kept for up to ttl, see NewTieredCache.  A size of 0, the
+// default, turns it off.
+func SetLocalCache(size int, ttl time.Duration) {
+	if size <= 0 {
+		stdNear = nil
+		return
+	}
+	stdNear, stdNearTTL = NewMemoryCache(size), nearTTL(ttl)
+}
+
+func (c *TieredCache) Get(ctx context.Context, key string) (GeoIPData, error) {
+	if geo, err := c.near.Get(ctx, key); err == nil {
+		return geo, nil
+	}
+	geo, err := c.far.Get(ctx, key)
+	if err != nil {
+		return geo, err
+	}
+	c.near.Set(ctx, key, geo, c.nearTTL)
+	return geo, nil
+}
+
+// Set writes the near copy even if far fails, so the answer is still
+// served during an outage.
+func (c *TieredCache) Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error {
+	c.near.Set(ctx, key, geo, c.localTTL(ttl))
+	return c.far.Set(ctx, key, geo, ttl)
+}
+
+func (c *TieredCache) Delete(ctx context.Context, key string) error {
+	c.near.Delete(ctx, key)
+	return c.far.Delete(ctx, key)
+}
+
+// GetMulti answers what it can from the near cache and asks far for the
+// rest.
+// ttl is far's, which the near copy never outlives.
+func (c *TieredCache) ttl(ctx context.Context, key string) (time.Duration, error) {
+	return remainingTTL(ctx, c.far, key)
+}
+
+func (c *TieredCache) GetMulti(ctx context.Context, keys []string) (map[string]GeoIPData, error) {
+	found := make(map[string]GeoIPData, len(keys))
+	var rest []string
+	for _, key := range keys {
+		if geo, err := c.near.Get(ctx, key); err == nil {
+			found[key] = geo
+		} else {
+			rest = append(rest, key)
+		}
+	}
+	if len(rest) == 0 {
+		return found, nil
+	}
+
+	if mg, ok := c.far.(multiGetter); ok {
+		far, err := mg.GetMulti(ctx, rest)
+		if err != nil {
+			return found, err
+		}
+		for key, geo := range far {
+			found[key] = geo
+			c.near.Set(ctx, key, geo, c.nearTTL)
+		}
+		return found, nil
+	}
+	for _, key := range rest {
+		geo, err := c.far.Get(ctx, key)
+		if errors.Is(err, ErrCacheMiss) {
+			continue
+		}
+		if err != nil {
+			return found, err
+		}
+		found[key] = geo
+		c.near.Set(ctx, key, geo, c.nearTTL)
+	}
+	return found, nil
+}
+
+// localTTL is the near lifetime of an entry living ttl in far.
+func (c *TieredCache) localTTL(ttl time.Duration) time.Duration {
+	if ttl <= 0 || c.nearTTL < ttl {
+		return c.nearTTL
+	}
+	return ttl
+}
@@ -0,0 +1,53 @@
+package me_geolocate
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const tracerName = "github.com/pootwaddle/me_geolocate"
+
+var noopTracer = noop.NewTracerProvider().Tracer(tracerName)
+
+// WithTracerProvider traces lookups with OpenTelemetry: a
+// geolocate.GetGeoData span per lookup (geolocate.GetGeoDataBatch per
+// batch), with child spans for the cache check and each provider call.
+// Spans carry geo.ip_class and geo.provider; geo.ip honours SetLogIPHash.
+// Without it nothing is traced.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(l *GeoLocator) { l.tracer = tp.Tracer(tracerName) }
+}
+
+// ipClass is the kind of address geo turned out to be, for span attributes.
+func ipClass(geo GeoIPData) string {
+	switch geo.Provider {
+	case "local", "non-routable", "reserved", "override":
+		return geo.Provider
+	}
+	return "public"
+}
+
+func endLookupSpan(span trace.Span, geo GeoIPData) {
+	span.SetAttributes(
+		attribute.String("geo.ip_class", ipClass(geo)),
+		attribute.String("geo.provider", geo.Provider),
+		attribute.Bool("geo.cache_hit", geo.CacheHit),
+	)
+	if !geo.Located && geo.Routable && geo.Error != "" {
+		span.SetStatus(codes.Error, geo.Error)
+	}
+	span.End()
+}
+
+func endUpstreamSpan(span trace.Span, status int, err error) {
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
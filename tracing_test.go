@@ -0,0 +1,45 @@
+package me_geolocate
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestWithTracerProvider(t *testing.T) {
+	useProvider(t, `{"ip":"8.8.8.8","isp":"Google LLC","country_code":"US","success":true}`)
+	rec := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec))
+	l := NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL(lookupURL), WithTracerProvider(tp))
+
+	l.GetGeoData(context.Background(), "8.8.8.8")
+
+	spans := rec.Ended()
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range spans {
+		byName[s.Name()] = s
+	}
+	root, ok := byName["geolocate.GetGeoData"]
+	if !ok || len(spans) != 3 {
+		t.Fatalf("want: GetGeoData, cache and upstream spans\ngot: %d spans\n", len(spans))
+	}
+	for _, name := range []string{"geolocate.cache", "geolocate.upstream"} {
+		if byName[name].Parent().SpanID() != root.SpanContext().SpanID() {
+			t.Errorf("%s want: child of GetGeoData\ngot: parent %s\n", name, byName[name].Parent().SpanID())
+		}
+	}
+
+	want := map[attribute.Key]string{"geo.ip_class": "public", "geo.provider": providerName}
+	for _, kv := range root.Attributes() {
+		if w, ok := want[kv.Key]; ok && kv.Value.AsString() != w {
+			t.Errorf("%s want: %s\ngot: %s\n", kv.Key, w, kv.Value.AsString())
+		}
+		delete(want, kv.Key)
+	}
+	if len(want) > 0 {
+		t.Errorf("want attributes: %v\ngot: missing\n", want)
+	}
+}
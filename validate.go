@@ -0,0 +1,83 @@
+package me_geolocate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidAnswer is returned, wrapped, when a provider's answer fails
+// WithValidation.
+var ErrInvalidAnswer = errors.New("me_geolocate: provider answer failed validation")
+
+// HasRequiredFields reports whether each of the named fields, by json name
+// as for MarshalSubset, is set: not empty, zero or the placeholder a
+// lookup starts from.  An unknown name is never set.
+func (geo GeoIPData) HasRequiredFields(fields ...string) bool {
+	byt, err := json.Marshal(geo)
+	if err != nil {
+		return false
+	}
+	all := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(byt, &all); err != nil {
+		return false
+	}
+	for _, f := range fields {
+		switch strings.TrimSpace(string(all[f])) {
+		case "", "null", `""`, "0", "false", `"--"`, `"-----"`:
+			return false
+		}
+		if f == "country_code" && unknownCountry(geo.CountryCode) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithValidation checks each provider answer before it is used: the
+// coordinates must be in range and the named fields set, see
+// HasRequiredFields.  An answer that fails counts as that provider
+// failing, so the chain moves on to the next one, see WithProviderChain.
+// Only an answer that passes is cached; if none does the lookup fails
+// with ErrInvalidAnswer, which WithNegativeTTL caches like any failure.
+func WithValidation(required ...string) Option {
+	return func(l *GeoLocator) {
+		l.validate = true
+		l.required = required
+	}
+}
+
+// validating is p, checked against WithValidation if it is set.
+func (l *GeoLocator) validating(p Provider) Provider {
+	if !l.validate {
+		return p
+	}
+	return &validatingProvider{Provider: p, required: l.required}
+}
+
+// validatingProvider fails answers from Provider that don't pass
+// WithValidation.  It sees the answer before lookupWith zeroes bad
+// coordinates.
+type validatingProvider struct {
+	Provider
+	required []string
+}
+
+func (p *validatingProvider) Lookup(ctx context.Context, geo *GeoIPData) error {
+	if err := p.Provider.Lookup(ctx, geo); err != nil {
+		return err
+	}
+	var err error
+	switch {
+	case !validCoordinates(geo.Latitude, geo.Longitude):
+		err = fmt.Errorf("%w: %s gave coordinates %f,%f for IP: %s", ErrInvalidAnswer, p.Name(), geo.Latitude, geo.Longitude, logIP(geo.IP))
+	case !geo.HasRequiredFields(p.required...):
+		err = fmt.Errorf("%w: %s left one of %s unset for IP: %s", ErrInvalidAnswer, p.Name(), strings.Join(p.required, ", "), logIP(geo.IP))
+	default:
+		return nil
+	}
+	geo.Error = err.Error()
+	return err
+}
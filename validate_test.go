@@ -0,0 +1,61 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestHasRequiredFields(t *testing.T) {
+	geo := newGeoIPData("8.8.8.8")
+	geo.ISP = "Google LLC"
+	geo.Latitude = 37.751
+	tests := []struct {
+		fields []string
+		want   bool
+	}{
+		{nil, true},
+		{[]string{"isp"}, true},
+		{[]string{"isp", "latitude"}, true},
+		{[]string{"city"}, false},
+		{[]string{"country_code"}, false},
+		{[]string{"longitude"}, false},
+		{[]string{"isp", "nope"}, false},
+	}
+	for _, tt := range tests {
+		if got := geo.HasRequiredFields(tt.fields...); got != tt.want {
+			t.Errorf("%v want: %v\ngot: %v\n", tt.fields, tt.want, got)
+		}
+	}
+}
+
+func TestWithValidation(t *testing.T) {
+	bad := providerServer(t, `{"status":"success","countryCode":"US","city":"Nowhere","lat":999,"lon":-97.822,"query":"8.8.8.8"}`, nil)
+	noCity := providerServer(t, `{"status":"success","countryCode":"US","lat":37.751,"lon":-97.822,"query":"8.8.8.8"}`, nil)
+	good := providerServer(t, `{"status":"success","countryCode":"US","city":"Wichita","lat":37.751,"lon":-97.822,"query":"8.8.8.8"}`, nil)
+
+	mem := NewMemoryCache(10)
+	l := NewGeoLocator(nil, WithCache(mem), WithValidation("city"),
+		WithProviderChain(&IPAPIProvider{URL: bad + "/%s"}, &IPAPIProvider{URL: noCity + "/%s"}, &IPAPIProvider{URL: good + "/%s"}))
+	defer l.Close()
+	geo, err := l.GetGeoData(context.Background(), "8.8.8.8")
+	if err != nil || geo.City != "Wichita" || geo.Latitude != 37.751 {
+		t.Errorf("want: Wichita 37.751 from the fallback\ngot: %s %f %v\n", geo.City, geo.Latitude, err)
+	}
+	if cached, _ := mem.Get(context.Background(), "8.8.8.8"); cached.City != "Wichita" {
+		t.Errorf("cached want: Wichita\ngot: %s\n", cached.City)
+	}
+
+	// none passes: nothing valid is cached, only the failure
+	mem = NewMemoryCache(10)
+	l = NewGeoLocator(nil, WithCache(mem), WithValidation("city"), WithNegativeTTL(time.Minute),
+		WithProviderChain(&IPAPIProvider{URL: bad + "/%s"}, &IPAPIProvider{URL: noCity + "/%s"}))
+	defer l.Close()
+	if _, err := l.GetGeoData(context.Background(), "8.8.8.8"); !errors.Is(err, ErrInvalidAnswer) {
+		t.Errorf("want: ErrInvalidAnswer\ngot: %v\n", err)
+	}
+	if cached, _ := mem.Get(context.Background(), "8.8.8.8"); cached.Provider != providerNegative || cached.CountryCode != "--" {
+		t.Errorf("cached want: a negative unknown\ngot: %+v\n", cached)
+	}
+}
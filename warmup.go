@@ -0,0 +1,115 @@
+package me_geolocate
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	warmupJitter  = time.Second // most a warmup waits before starting
+	warmupTimeout = 10 * time.Second
+)
+
+// WithWarmup has NewGeoLocator ping Redis and open a connection to the
+// first provider in the background, so the first real lookup doesn't pay
+// for DNS and the TLS handshake.  It starts after a random wait of up to a
+// second, so a fleet restarting together doesn't hit the provider at
+// once.  The provider request asks about no IP in particular and its
+// answer is thrown away.  Failures are logged, nothing more; Close waits
+// for a warmup still running.
+func WithWarmup(on bool) Option {
+	return func(l *GeoLocator) { l.warmup = on }
+}
+
+// warmer is a Provider that can open its connection ahead of the first
+// lookup, see WithWarmup.
+type warmer interface {
+	warm(ctx context.Context) error
+}
+
+// startWarmup runs WithWarmup's pings in the background.
+func (l *GeoLocator) startWarmup() {
+	if !l.startBackground() {
+		return
+	}
+	started := l.spawn(func() {
+		defer l.refreshes.Done()
+		ctx, cancel := l.backgroundContext(context.Background(), warmupJitter+warmupTimeout)
+		defer cancel()
+		if sleep(ctx, time.Duration(rand.Int63n(int64(warmupJitter)))) != nil {
+			return
+		}
+
+		client := l.redisClient
+		if c, ok := l.ownsCache.(redis.UniversalClient); ok {
+			client = c
+		}
+		if client != nil {
+			if err := client.Ping(ctx).Err(); err != nil {
+				l.warnf("Warmup Redis ping failed - %s", err)
+			}
+		}
+
+		if w, ok := l.providers[0].(warmer); ok {
+			if err := w.warm(ctx); err != nil {
+				l.warnf("Warmup of %s failed - %s", l.providers[0].Name(), err)
+				return
+			}
+			l.debugf("Warmed up %s", l.providers[0].Name())
+		}
+	})
+	if !started {
+		l.refreshes.Done()
+	}
+}
+
+// warmGet GETs url, for the connection rather than the answer.
+func warmGet(ctx context.Context, client *http.Client, url string) error {
+	if client == nil {
+		client = httpClient
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	// drain it so the connection goes back to the pool
+	io.Copy(io.Discard, resp.Body)
+	return resp.Body.Close()
+}
+
+// warm asks geoiplookup.io about the caller's own address.
+func (p *GeoIPLookupProvider) warm(ctx context.Context) error {
+	url := p.URL
+	if url == "" {
+		url = lookupURL
+	}
+	return warmGet(ctx, p.Client, fmt.Sprintf(url, ""))
+}
+
+// warm asks ip-api.com about the caller's own address.
+func (p *IPAPIProvider) warm(ctx context.Context) error {
+	url := p.URL
+	if url == "" {
+		url = ipAPIURL
+	}
+	return warmGet(ctx, p.Client, fmt.Sprintf(url, ""))
+}
+
+// warm asks ipinfo.io about the caller's own address.
+func (p *IPInfoProvider) warm(ctx context.Context) error {
+	url := "https://ipinfo.io/json"
+	if p.URL != "" {
+		url = fmt.Sprintf(p.URL, "")
+	}
+	return warmGet(ctx, p.Client, url)
+}
@@ -0,0 +1,33 @@
+package me_geolocate
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestWithWarmup(t *testing.T) {
+	mr := miniredis.RunT(t)
+	var paths []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	l := NewGeoLocator(nil, WithRedisAddr(mr.Addr()), WithLookupURL(srv.URL+"/%s"), WithWarmup(true))
+	l.Close() // waits for the warmup
+	if len(paths) != 1 || paths[0] != "/" {
+		t.Errorf("want: one request for the caller's own address\ngot: %v\n", paths)
+	}
+	if n := mr.CommandCount(); n == 0 {
+		t.Errorf("want: a Redis ping\ngot: no commands\n")
+	}
+
+	// a provider that can't be reached doesn't stop the locator
+	l = NewGeoLocator(nil, WithCache(NewMemoryCache(10)), WithLookupURL("http://127.0.0.1:1/%s"), WithWarmup(true))
+	if err := l.Close(); err != nil {
+		t.Errorf("want: nil\ngot: %s\n", err)
+	}
+}
@@ -0,0 +1,214 @@
+package me_geolocate
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	writeRetryMinDelay = 100 * time.Millisecond // first wait, doubled after each pass
+	writeRetryMaxDelay = 5 * time.Second
+	writeRetryTimeout  = 5 * time.Second // per retried write
+	writeRetryWindow   = time.Minute     // default for WithCacheWriteRetry
+)
+
+// WithCacheWriteRetry keeps up to size cache writes that failed, e.g.
+// while Redis restarts, and retries them with backoff for up to window
+// each (0 means a minute), so a provider answer already paid for isn't
+// lost to a blip.  When the queue is full the oldest write is dropped.
+// Writes dropped or given up on are counted in Stats.  Close makes a last
+// attempt at what is still queued.  By default a failed write is only
+// logged.
+func WithCacheWriteRetry(size int, window time.Duration) Option {
+	return func(l *GeoLocator) {
+		if window <= 0 {
+			window = writeRetryWindow
+		}
+		l.writeRetrySize, l.writeRetryWindow = size, window
+	}
+}
+
+// retryingCache queues the writes to Cache that fail, see
+// WithCacheWriteRetry.
+type retryingCache struct {
+	Cache
+	queue *writeQueue
+}
+
+func (c *retryingCache) Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error {
+	err := c.Cache.Set(ctx, key, geo, ttl)
+	if err != nil {
+		c.queue.add(queuedWrite{key: key, geo: geo, ttl: ttl, until: time.Now().Add(c.queue.window)})
+	}
+	return err
+}
+
+func (c *retryingCache) GetMulti(ctx context.Context, keys []string) (map[string]GeoIPData, error) {
+	if mg, ok := c.Cache.(multiGetter); ok {
+		return mg.GetMulti(ctx, keys)
+	}
+	found := make(map[string]GeoIPData, len(keys))
+	for _, key := range keys {
+		if geo, err := c.Cache.Get(ctx, key); err == nil {
+			found[key] = geo
+		}
+	}
+	return found, nil
+}
+
+func (c *retryingCache) ttl(ctx context.Context, key string) (time.Duration, error) {
+	return remainingTTL(ctx, c.Cache, key)
+}
+
+type queuedWrite struct {
+	key   string
+	geo   GeoIPData
+	ttl   time.Duration
+	until time.Time // given up on after this
+}
+
+// writeQueue holds failed writes to cache and retries them from one
+// goroutine, running only while there is something queued.
+type writeQueue struct {
+	cache   Cache
+	size    int
+	window  time.Duration
+	dropped *atomic.Int64 // Stats.WritesDropped
+	spawn   func(func()) bool
+
+	mu      sync.Mutex
+	pending []queuedWrite // oldest first, one per key
+	running bool
+	closed  bool
+	stop    chan struct{}
+	done    sync.WaitGroup
+}
+
+// newWriteQueue retries writes to c, starting its goroutine with spawn,
+// see GeoLocator.spawn.
+func newWriteQueue(c Cache, size int, window time.Duration, dropped *atomic.Int64, spawn func(func()) bool) *writeQueue {
+	return &writeQueue{cache: c, size: max(size, 1), window: window, dropped: dropped, spawn: spawn, stop: make(chan struct{})}
+}
+
+// add queues w, replacing an older write of the same key.
+func (q *writeQueue) add(w queuedWrite) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		q.dropped.Add(1)
+		return
+	}
+	q.pending = q.merge(q.pending, []queuedWrite{w})
+	if !q.running {
+		// if the pool is full, the next failed write tries again
+		q.done.Add(1)
+		q.running = q.spawn(q.run)
+		if !q.running {
+			q.done.Done()
+		}
+	}
+}
+
+// merge appends newer to older, keeping the newest write per key and at
+// most size writes.  q.mu must be held.
+func (q *writeQueue) merge(older, newer []queuedWrite) []queuedWrite {
+	latest := make(map[string]bool, len(newer))
+	for _, w := range newer {
+		latest[w.key] = true
+	}
+	var out []queuedWrite
+	for _, w := range older {
+		if !latest[w.key] {
+			out = append(out, w)
+		}
+	}
+	out = append(out, newer...)
+	if over := len(out) - q.size; over > 0 {
+		q.dropped.Add(int64(over))
+		out = out[over:]
+	}
+	return out
+}
+
+// len is how many writes are waiting, 0 for a nil queue.
+func (q *writeQueue) len() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+func (q *writeQueue) run() {
+	defer q.done.Done()
+	delay := writeRetryMinDelay
+	for {
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-q.stop:
+			timer.Stop()
+			ctx, cancel := context.WithTimeout(context.Background(), writeRetryTimeout)
+			q.retry(ctx)
+			cancel()
+			q.mu.Lock()
+			q.dropped.Add(int64(len(q.pending)))
+			q.pending, q.running = nil, false
+			q.mu.Unlock()
+			return
+		}
+		if q.retry(context.Background()) {
+			return
+		}
+		delay = min(delay*2, writeRetryMaxDelay)
+	}
+}
+
+// retry makes one pass over the queue within ctx.  It reports whether
+// the queue emptied, in which case run has stopped.
+func (q *writeQueue) retry(ctx context.Context) bool {
+	q.mu.Lock()
+	batch := q.pending
+	q.pending = nil
+	q.mu.Unlock()
+
+	var failed []queuedWrite
+	now := time.Now()
+	for _, w := range batch {
+		if now.After(w.until) {
+			q.dropped.Add(1)
+			continue
+		}
+		wctx, cancel := context.WithTimeout(ctx, writeRetryTimeout)
+		err := q.cache.Set(wctx, w.key, w.geo, w.ttl)
+		cancel()
+		if err != nil {
+			failed = append(failed, w)
+		}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.pending = q.merge(failed, q.pending)
+	if len(q.pending) == 0 {
+		q.running = false
+		return true
+	}
+	return false
+}
+
+// close stops retrying after one last pass, dropping what still fails.
+func (q *writeQueue) close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	close(q.stop)
+	q.mu.Unlock()
+	q.done.Wait()
+}
@@ -0,0 +1,56 @@
+package me_geolocate
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyCache is a MemoryCache whose writes fail while down is set.
+type flakyCache struct {
+	*MemoryCache
+	down atomic.Bool
+}
+
+func (c *flakyCache) Set(ctx context.Context, key string, geo GeoIPData, ttl time.Duration) error {
+	if c.down.Load() {
+		return errors.New("connection refused")
+	}
+	return c.MemoryCache.Set(ctx, key, geo, ttl)
+}
+
+func TestWithCacheWriteRetry(t *testing.T) {
+	url := providerServer(t, `{"isp":"Google LLC","country_code":"US","success":true}`, nil)
+	cache := &flakyCache{MemoryCache: NewMemoryCache(10)}
+	cache.down.Store(true)
+	l := NewGeoLocator(nil, WithCache(cache), WithLookupURL(url+"/%s"), WithCacheFailover(0, 0), WithCacheWriteRetry(2, time.Minute))
+
+	ctx := context.Background()
+	for _, ip := range []string{"8.8.8.8", "1.1.1.1", "9.9.9.9"} {
+		l.GetGeoData(ctx, ip)
+	}
+	if s := l.Stats(); s.WritesQueued != 2 || s.WritesDropped != 1 {
+		t.Errorf("want: 2 queued, the oldest dropped\ngot: %d %d\n", s.WritesQueued, s.WritesDropped)
+	}
+
+	cache.down.Store(false)
+	deadline := time.Now().Add(5 * time.Second)
+	for l.Stats().WritesQueued > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for ip, want := range map[string]bool{"8.8.8.8": false, "1.1.1.1": true, "9.9.9.9": true} {
+		if _, err := cache.Get(ctx, ip); (err == nil) != want {
+			t.Errorf("%s cached want: %v\ngot: %v\n", ip, want, err == nil)
+		}
+	}
+
+	// Close tries once more, then gives up
+	cache.down.Store(true)
+	l.GetGeoData(ctx, "8.8.8.8")
+	l.Close()
+	if s := l.Stats(); s.WritesQueued != 0 || s.WritesDropped != 2 {
+		t.Errorf("after Close want: none queued, 2 dropped\ngot: %d %d\n", s.WritesQueued, s.WritesDropped)
+	}
+}